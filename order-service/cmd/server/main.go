@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -19,6 +21,9 @@ import (
 	"order-service/internal/repository"
 	"order-service/internal/service"
 	"order-service/pkg/eventbus"
+	"shared/auth"
+	"shared/jwt"
+	"shared/outbox"
 )
 
 func main() {
@@ -46,14 +51,28 @@ func main() {
 	eventBus := eventbus.NewKafkaEventBus(cfg.KafkaBrokers)
 	defer eventBus.Close()
 
+	// Service tokens are signed per call, so they only need to outlive one
+	jwtManager := jwt.NewManager(cfg.JWTSecret, 5*time.Minute)
+	serviceJWTManager := jwt.NewManager(cfg.ServiceJWTSecret, 5*time.Minute)
+
 	// Initialize Clients
-	productCli, err := client.NewProductClient(cfg.ProductServiceAddr, 5*time.Second)
+	clientOpts := client.Options{
+		Timeout:                 cfg.ClientTimeout,
+		MaxAttempts:             cfg.ClientMaxAttempts,
+		InitialBackoff:          cfg.ClientInitialBackoff,
+		MaxBackoff:              cfg.ClientMaxBackoff,
+		HedgingDelay:            cfg.ClientHedgingDelay,
+		BreakerFailureThreshold: cfg.BreakerFailureThreshold,
+		BreakerOpenTimeout:      cfg.BreakerOpenTimeout,
+		Credentials:             auth.NewServiceCredentials(serviceJWTManager, "order-service"),
+	}
+	productCli, err := client.NewProductClient(cfg.ProductServiceAddr, clientOpts)
 	if err != nil {
 		log.Fatalf("failed to create product client: %v", err)
 	}
 	defer productCli.Close()
 
-	paymentCli, err := client.NewPaymentClient(cfg.PaymentServiceAddr, 5*time.Second)
+	paymentCli, err := client.NewPaymentClient(cfg.PaymentServiceAddr, clientOpts)
 	if err != nil {
 		log.Fatalf("failed to create payment client: %v", err)
 	}
@@ -61,12 +80,101 @@ func main() {
 
 	// Initialize Repository
 	orderRepo := repository.NewMongoOrderRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := orderRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create order indexes: %v", err)
+	}
+	sagaRepo := repository.NewMongoSagaRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := sagaRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create checkout saga indexes: %v", err)
+	}
+	outboxRepo := outbox.NewMongoRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second, cfg.OutboxRetention)
+	if err := outboxRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create outbox indexes: %v", err)
+	}
+	idempotencyRepo := repository.NewMongoIdempotencyRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := idempotencyRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create idempotency indexes: %v", err)
+	}
+	promotionRepo := repository.NewMongoPromotionRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := promotionRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create promotion indexes: %v", err)
+	}
+	cartRepo := repository.NewMongoCartRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := cartRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create cart indexes: %v", err)
+	}
+	subscriptionRepo := repository.NewMongoSubscriptionRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := subscriptionRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create subscription indexes: %v", err)
+	}
+	transactor := repository.NewMongoTransactor(mongoClient)
+
+	taxes, err := service.NewTaxTable(cfg.TaxMode, cfg.TaxRates)
+	if err != nil {
+		log.Fatalf("invalid tax configuration: %v", err)
+	}
+	shippingRates, err := service.NewRateTable(cfg.ShippingRates)
+	if err != nil {
+		log.Fatalf("invalid shipping configuration: %v", err)
+	}
+	if cfg.SellerCommissionRate < 0 || cfg.SellerCommissionRate > 10000 {
+		log.Fatalf("invalid seller commission rate: %d basis points", cfg.SellerCommissionRate)
+	}
+	// Unpaid orders must not outlive the stock reserved for them
+	if cfg.OrderExpiryTTL > cfg.ReservationTTL {
+		log.Fatalf("ORDER_EXPIRY_TTL (%s) must not exceed RESERVATION_TTL (%s)", cfg.OrderExpiryTTL, cfg.ReservationTTL)
+	}
+	dunning := service.DunningPolicy{
+		MaxAttempts: cfg.SubscriptionMaxAttempts,
+		RetryDelay:  cfg.SubscriptionRetryDelay,
+	}
+	if err := dunning.Validate(); err != nil {
+		log.Fatalf("invalid subscription dunning policy: %v", err)
+	}
 
 	// Initialize Services
-	orderService := service.NewOrderService(orderRepo, productCli, paymentCli, eventBus, 5*time.Second)
+	orderService := service.NewOrderService(
+		orderRepo, sagaRepo, outboxRepo, idempotencyRepo, promotionRepo, cartRepo, subscriptionRepo, transactor,
+		productCli, paymentCli,
+		service.PriceMismatchPolicy(cfg.PriceMismatchPolicy),
+		taxes,
+		shippingRates,
+		int64(cfg.SellerCommissionRate),
+		cfg.ReservationTTL,
+		cfg.IdempotencyTTL,
+		cfg.GuestCartTTL,
+		[]byte(cfg.PaymentNotificationSecret),
+		5*time.Second,
+	)
+	outboxRelay := outbox.NewRelay(outboxRepo, eventBus, 100, 30*time.Second)
+
+	// Start background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go orderService.RunCheckoutRecovery(workerCtx, cfg.CheckoutRecoveryInterval, cfg.CheckoutStaleAfter, cfg.CheckoutPaymentDeadline)
+	go orderService.RunOrderExpiry(workerCtx, cfg.OrderExpiryInterval, cfg.OrderExpiryTTL)
+	go orderService.RunSubscriptions(workerCtx, cfg.SubscriptionInterval, dunning)
+	go outboxRelay.Run(workerCtx, cfg.OutboxRelayInterval)
+
+	// Consume payment status events
+	paymentEvents := eventbus.NewKafkaSubscriber(cfg.KafkaBrokers, cfg.KafkaGroupID, handler.PaymentStatusTopic)
+	defer paymentEvents.Close()
+	paymentEventHandler := handler.NewPaymentEventHandler(orderService)
+	go paymentEvents.Run(workerCtx, paymentEventHandler.Handle, 5*time.Second)
+
+	// Serve metrics
+	go func() {
+		if err := http.ListenAndServe(cfg.MetricsAddr, expvar.Handler()); err != nil {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
 
 	// Initialize gRPC Server
-	grpcServer := grpc.NewServer()
+	authInterceptor := auth.NewInterceptor(jwtManager, serviceJWTManager, handler.MethodAccess)
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(handler.ErrorInterceptor, authInterceptor.Unary),
+		grpc.ChainStreamInterceptor(handler.ErrorStreamInterceptor, authInterceptor.Stream),
+	)
 	orderHandler := handler.NewOrderGRPCHandler(orderService)
 	order.RegisterOrderServiceServer(grpcServer, orderHandler)
 
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// breakerMetrics exposes the state and counters of every breaker on
+// /debug/vars under grpc_client_breakers.<upstream>.
+var breakerMetrics = expvar.NewMap("grpc_client_breakers")
+
+// CircuitBreaker stops calling an upstream after failureThreshold consecutive
+// failures. After openTimeout a single probe call is let through: its
+// success closes the breaker again, its failure reopens it.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	metrics  *expvar.Map
+	stateVar *expvar.String
+}
+
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	b := &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		state:            BreakerClosed,
+		metrics:          new(expvar.Map).Init(),
+		stateVar:         new(expvar.String),
+	}
+	b.stateVar.Set(string(BreakerClosed))
+	b.metrics.Set("state", b.stateVar)
+	breakerMetrics.Set(name, b.metrics)
+	return b
+}
+
+// allow reports whether a call may go through.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	b.metrics.Add("failures", 1)
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		if b.state != BreakerOpen {
+			b.setState(BreakerOpen)
+		}
+	}
+}
+
+// setState must be called with mu held.
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	b.stateVar.Set(string(state))
+	b.metrics.Add("transitions_to_"+string(state), 1)
+}
+
+// UnaryClientInterceptor rejects calls with codes.Unavailable while the
+// breaker is open. Only errors that point at an unhealthy upstream count as
+// failures; business errors such as NotFound do not.
+func (b *CircuitBreaker) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if !b.allow() {
+		b.metrics.Add("rejected", 1)
+		return status.Errorf(codes.Unavailable, "circuit breaker for %s is open", b.name)
+	}
+
+	b.metrics.Add("calls", 1)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	b.record(!isUpstreamFailure(err))
+	return err
+}
+
+func isUpstreamFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// breakerStep is a call through the breaker, or, with elapse set, the open
+// timeout running out.
+type breakerStep struct {
+	elapse      bool
+	fail        bool
+	wantAllowed bool
+	wantState   BreakerState
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "failures below the threshold keep it closed",
+			steps: []breakerStep{
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "consecutive failures open it",
+			steps: []breakerStep{
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerOpen},
+				{wantAllowed: false, wantState: BreakerOpen},
+			},
+		},
+		{
+			name: "successful probe closes it",
+			steps: []breakerStep{
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerOpen},
+				{elapse: true},
+				{wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "failed probe reopens it",
+			steps: []breakerStep{
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerClosed},
+				{fail: true, wantAllowed: true, wantState: BreakerOpen},
+				{elapse: true},
+				{fail: true, wantAllowed: true, wantState: BreakerOpen},
+				{wantAllowed: false, wantState: BreakerOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", 3, time.Minute)
+			for i, step := range tt.steps {
+				if step.elapse {
+					b.openedAt = b.openedAt.Add(-b.openTimeout)
+					continue
+				}
+				allowed := b.allow()
+				if allowed != step.wantAllowed {
+					t.Fatalf("step %d: allow() = %v, want %v", i, allowed, step.wantAllowed)
+				}
+				if allowed {
+					b.record(!step.fail)
+				}
+				if b.state != step.wantState {
+					t.Fatalf("step %d: state = %s, want %s", i, b.state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Minute)
+	b.allow()
+	b.record(false)
+	b.openedAt = b.openedAt.Add(-b.openTimeout)
+
+	if !b.allow() {
+		t.Fatal("allow() = false for the probe")
+	}
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want %s", b.state, BreakerHalfOpen)
+	}
+	if b.allow() {
+		t.Error("allow() = true while the probe is in flight")
+	}
+}
+
+func TestIsUpstreamFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"success", nil, false},
+		{"unavailable", status.Error(codes.Unavailable, "down"), true},
+		{"deadline exceeded", status.Error(codes.DeadlineExceeded, "slow"), true},
+		{"resource exhausted", status.Error(codes.ResourceExhausted, "busy"), true},
+		{"not found", status.Error(codes.NotFound, "missing"), false},
+		{"invalid argument", status.Error(codes.InvalidArgument, "bad"), false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUpstreamFailure(tt.err); got != tt.want {
+				t.Errorf("isUpstreamFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Options configure how a client talks to its upstream.
+type Options struct {
+	// Timeout bounds every call, retries and hedges included.
+	Timeout time.Duration
+
+	// Retries of idempotent calls failing with UNAVAILABLE.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// HedgingDelay is how long a read waits before a hedged copy is sent.
+	HedgingDelay time.Duration
+
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+
+	// Credentials, if set, authenticate every call to the upstream.
+	Credentials credentials.PerRPCCredentials
+}
+
+// methodPolicy lists the methods of a service that are safe to send more
+// than once. Reads are hedged, idempotent writes are retried.
+type methodPolicy struct {
+	service   string
+	hedged    []string
+	retryable []string
+}
+
+// dial connects lazily to addr: the connection is established on the first
+// call, so the order service starts while its dependencies are down. Calls
+// go through a circuit breaker named after the upstream.
+func dial(name, addr string, policy methodPolicy, opts Options) (*grpc.ClientConn, error) {
+	serviceConfig, err := buildServiceConfig(policy, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	breaker := NewCircuitBreaker(name, opts.BreakerFailureThreshold, opts.BreakerOpenTimeout)
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(breaker.UnaryClientInterceptor),
+	}
+	if opts.Credentials != nil {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(opts.Credentials))
+	}
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type hedgingPolicy struct {
+	MaxAttempts         int      `json:"maxAttempts"`
+	HedgingDelay        string   `json:"hedgingDelay"`
+	NonFatalStatusCodes []string `json:"nonFatalStatusCodes"`
+}
+
+type methodConfig struct {
+	Name          []methodName   `json:"name"`
+	RetryPolicy   *retryPolicy   `json:"retryPolicy,omitempty"`
+	HedgingPolicy *hedgingPolicy `json:"hedgingPolicy,omitempty"`
+}
+
+type serviceConfig struct {
+	LoadBalancingPolicy string         `json:"loadBalancingPolicy"`
+	MethodConfig        []methodConfig `json:"methodConfig,omitempty"`
+}
+
+// buildServiceConfig renders the gRPC service config carrying the retry and
+// hedging policies. gRPC allows at most 5 attempts.
+func buildServiceConfig(policy methodPolicy, opts Options) (string, error) {
+	attempts := min(max(opts.MaxAttempts, 1), 5)
+	config := serviceConfig{LoadBalancingPolicy: "round_robin"}
+
+	if attempts > 1 && len(policy.retryable) > 0 {
+		config.MethodConfig = append(config.MethodConfig, methodConfig{
+			Name: methodNames(policy.service, policy.retryable),
+			RetryPolicy: &retryPolicy{
+				MaxAttempts:          attempts,
+				InitialBackoff:       durationString(opts.InitialBackoff),
+				MaxBackoff:           durationString(opts.MaxBackoff),
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			},
+		})
+	}
+	if attempts > 1 && len(policy.hedged) > 0 {
+		config.MethodConfig = append(config.MethodConfig, methodConfig{
+			Name: methodNames(policy.service, policy.hedged),
+			HedgingPolicy: &hedgingPolicy{
+				MaxAttempts:         attempts,
+				HedgingDelay:        durationString(opts.HedgingDelay),
+				NonFatalStatusCodes: []string{"UNAVAILABLE"},
+			},
+		})
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func methodNames(service string, methods []string) []methodName {
+	names := make([]methodName, 0, len(methods))
+	for _, method := range methods {
+		names = append(names, methodName{Service: service, Method: method})
+	}
+	return names
+}
+
+// durationString formats d the way the service config expects, e.g. "0.1s".
+func durationString(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IsUnavailable reports whether err means the upstream could not be reached
+// or did not answer in time, as opposed to rejecting the request.
+func IsUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// IsRejected reports whether the upstream refused the request as invalid or
+// not allowed, so that it had no effect.
+func IsRejected(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.NotFound:
+		return true
+	}
+	return false
+}
+
+// IsNotFound reports whether the upstream has no such resource.
+func IsNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+// FailedProducts returns the products named by the precondition failures
+// attached to an upstream error, e.g. the products that ran out of stock.
+func FailedProducts(err error) []string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+
+	var productIDs []string
+	for _, detail := range st.Details() {
+		if failure, ok := detail.(*errdetails.PreconditionFailure); ok {
+			for _, violation := range failure.Violations {
+				productIDs = append(productIDs, violation.Subject)
+			}
+		}
+	}
+	return productIDs
+}
@@ -7,22 +7,24 @@ import (
 	"order-service/gen/payment"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
+// paymentPolicy hedges status reads and retries charges and refunds, which
+// the order service always sends with an idempotency key.
+var paymentPolicy = methodPolicy{
+	service:   "payment.PaymentService",
+	hedged:    []string{"GetPaymentStatus"},
+	retryable: []string{"CreatePayment", "ProcessRefund"},
+}
+
 type PaymentClient struct {
 	client  payment.PaymentServiceClient
 	conn    *grpc.ClientConn
 	timeout time.Duration
 }
 
-func NewPaymentClient(addr string, timeout time.Duration) (*PaymentClient, error) {
-	conn, err := grpc.Dial(addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
-		grpc.WithBlock(),
-		grpc.WithTimeout(timeout),
-	)
+func NewPaymentClient(addr string, opts Options) (*PaymentClient, error) {
+	conn, err := dial("payment-service", addr, paymentPolicy, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +32,7 @@ func NewPaymentClient(addr string, timeout time.Duration) (*PaymentClient, error
 	return &PaymentClient{
 		client:  payment.NewPaymentServiceClient(conn),
 		conn:    conn,
-		timeout: timeout,
+		timeout: opts.Timeout,
 	}, nil
 }
 
@@ -44,3 +46,30 @@ func (c *PaymentClient) CreatePayment(ctx context.Context, req *payment.PaymentR
 
 	return c.client.CreatePayment(ctx, req)
 }
+
+func (c *PaymentClient) ProcessRefund(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.ProcessRefund(ctx, req)
+}
+
+func (c *PaymentClient) GetPaymentStatus(ctx context.Context, paymentID string) (*payment.PaymentStatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.GetPaymentStatus(ctx, &payment.GetPaymentStatusRequest{
+		PaymentId: paymentID,
+	})
+}
+
+// GetPaymentStatusByKey looks a payment up by the idempotency key of the
+// CreatePayment that created it.
+func (c *PaymentClient) GetPaymentStatusByKey(ctx context.Context, idempotencyKey string) (*payment.PaymentStatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.GetPaymentStatus(ctx, &payment.GetPaymentStatusRequest{
+		IdempotencyKey: idempotencyKey,
+	})
+}
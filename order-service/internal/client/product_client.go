@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"order-service/gen/product"
+
+	"google.golang.org/grpc"
+)
+
+// productPolicy hedges catalog reads and retries the reservation calls, which
+// the product service applies at most once per order or reservation. Stock
+// updates are not idempotent and are never sent twice.
+var productPolicy = methodPolicy{
+	service:   "product.ProductService",
+	hedged:    []string{"ValidateProducts", "GetProductDetails"},
+	retryable: []string{"ReserveStock", "CommitReservation", "ReleaseReservation"},
+}
+
+type ProductClient struct {
+	client  product.ProductServiceClient
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+func NewProductClient(addr string, opts Options) (*ProductClient, error) {
+	conn, err := dial("product-service", addr, productPolicy, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProductClient{
+		client:  product.NewProductServiceClient(conn),
+		conn:    conn,
+		timeout: opts.Timeout,
+	}, nil
+}
+
+func (c *ProductClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *ProductClient) ValidateProducts(ctx context.Context, items []*product.ProductItem) (*product.ValidateProductsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.ValidateProducts(ctx, &product.ValidateProductsRequest{
+		Items: items,
+	})
+}
+
+func (c *ProductClient) GetProductDetails(ctx context.Context, productIDs []string) (*product.GetProductDetailsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.GetProductDetails(ctx, &product.GetProductDetailsRequest{
+		ProductIds: productIDs,
+	})
+}
+
+func (c *ProductClient) UpdateStock(ctx context.Context, items []*product.ProductItem, operation product.StockOperation) (*product.UpdateStockResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.UpdateStock(ctx, &product.UpdateStockRequest{
+		Items:     items,
+		Operation: operation,
+	})
+}
+
+func (c *ProductClient) ReserveStock(ctx context.Context, orderID string, items []*product.ProductItem, ttl time.Duration) (*product.ReservationResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.ReserveStock(ctx, &product.ReserveStockRequest{
+		OrderId:    orderID,
+		Items:      items,
+		TtlSeconds: int32(ttl / time.Second),
+	})
+}
+
+func (c *ProductClient) CommitReservation(ctx context.Context, reservationID string) (*product.ReservationResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.CommitReservation(ctx, &product.ReservationRequest{
+		ReservationId: reservationID,
+	})
+}
+
+func (c *ProductClient) ReleaseReservation(ctx context.Context, reservationID string) (*product.ReservationResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.ReleaseReservation(ctx, &product.ReservationRequest{
+		ReservationId: reservationID,
+	})
+}
@@ -1,20 +1,60 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	GRPCPort           string
-	MongoURI           string
-	MongoDB            string
-	KafkaBrokers       []string
-	ProductServiceAddr string
-	PaymentServiceAddr string
+	GRPCPort                 string
+	MongoURI                 string
+	MongoDB                  string
+	KafkaBrokers             []string
+	ProductServiceAddr       string
+	PaymentServiceAddr       string
+	CheckoutRecoveryInterval time.Duration
+	CheckoutStaleAfter       time.Duration
+	CheckoutPaymentDeadline  time.Duration
+	OrderExpiryInterval      time.Duration
+	OrderExpiryTTL           time.Duration
+	ReservationTTL           time.Duration
+	SubscriptionInterval     time.Duration
+	SubscriptionRetryDelay   time.Duration
+	SubscriptionMaxAttempts  int
+	OutboxRelayInterval      time.Duration
+	OutboxRetention          time.Duration
+	PriceMismatchPolicy      string
+	TaxMode                  string
+	TaxRates                 []string
+	ShippingRates            []string
+	SellerCommissionRate     int
+	IdempotencyTTL           time.Duration
+	GuestCartTTL             time.Duration
+	// PaymentNotificationSecret is shared with the payment service to sign
+	// payment notifications.
+	PaymentNotificationSecret string
+	// JWTSecret verifies the access tokens issued by user-service.
+	JWTSecret string
+	// ServiceJWTSecret signs the calls of this service to the others and
+	// verifies theirs. It must differ from JWTSecret.
+	ServiceJWTSecret string
+	KafkaGroupID     string
+	// Resilience of the product and payment clients
+	ClientTimeout           time.Duration
+	ClientMaxAttempts       int
+	ClientInitialBackoff    time.Duration
+	ClientMaxBackoff        time.Duration
+	ClientHedgingDelay      time.Duration
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+	// MetricsAddr serves the expvar metrics on /debug/vars.
+	MetricsAddr string
 }
 
 func Load() (*Config, error) {
@@ -22,13 +62,61 @@ func Load() (*Config, error) {
 		log.Println("no .env file found")
 	}
 
+	notificationSecret := getEnv("PAYMENT_NOTIFICATION_SECRET", "")
+	if notificationSecret == "" {
+		return nil, errors.New("PAYMENT_NOTIFICATION_SECRET is required")
+	}
+
+	jwtSecret := getEnv("JWT_SECRET", "")
+	if jwtSecret == "" {
+		return nil, errors.New("JWT_SECRET is required")
+	}
+
+	serviceJWTSecret := getEnv("SERVICE_JWT_SECRET", "")
+	if serviceJWTSecret == "" {
+		return nil, errors.New("SERVICE_JWT_SECRET is required")
+	}
+	if serviceJWTSecret == jwtSecret {
+		return nil, errors.New("SERVICE_JWT_SECRET must differ from JWT_SECRET")
+	}
+
 	return &Config{
-		GRPCPort:           getEnv("GRPC_PORT", "50052"),
-		MongoURI:           getEnv("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDB:            getEnv("MONGO_DB", "order_service"),
-		KafkaBrokers:       getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
-		ProductServiceAddr: getEnv("PRODUCT_SERVICE_ADDR", "product-service:50051"),
-		PaymentServiceAddr: getEnv("PAYMENT_SERVICE_ADDR", "payment-service:50053"),
+		GRPCPort:                  getEnv("GRPC_PORT", "50052"),
+		MongoURI:                  getEnv("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:                   getEnv("MONGO_DB", "order_service"),
+		KafkaBrokers:              getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
+		ProductServiceAddr:        getEnv("PRODUCT_SERVICE_ADDR", "product-service:50051"),
+		PaymentServiceAddr:        getEnv("PAYMENT_SERVICE_ADDR", "payment-service:50053"),
+		CheckoutRecoveryInterval:  getEnvAsDuration("CHECKOUT_RECOVERY_INTERVAL", 30*time.Second),
+		CheckoutStaleAfter:        getEnvAsDuration("CHECKOUT_STALE_AFTER", time.Minute),
+		CheckoutPaymentDeadline:   getEnvAsDuration("CHECKOUT_PAYMENT_DEADLINE", 15*time.Minute),
+		OrderExpiryInterval:       getEnvAsDuration("ORDER_EXPIRY_INTERVAL", time.Minute),
+		OrderExpiryTTL:            getEnvAsDuration("ORDER_EXPIRY_TTL", 30*time.Minute),
+		ReservationTTL:            getEnvAsDuration("RESERVATION_TTL", 30*time.Minute),
+		SubscriptionInterval:      getEnvAsDuration("SUBSCRIPTION_INTERVAL", time.Minute),
+		SubscriptionRetryDelay:    getEnvAsDuration("SUBSCRIPTION_RETRY_DELAY", 24*time.Hour),
+		SubscriptionMaxAttempts:   getEnvAsInt("SUBSCRIPTION_MAX_PAYMENT_ATTEMPTS", 4),
+		OutboxRelayInterval:       getEnvAsDuration("OUTBOX_RELAY_INTERVAL", time.Second),
+		OutboxRetention:           getEnvAsDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+		PriceMismatchPolicy:       getEnv("PRICE_MISMATCH_POLICY", "reject"),
+		TaxMode:                   getEnv("TAX_MODE", "inclusive"),
+		TaxRates:                  getEnvAsSlice("TAX_RATES", []string{"ID=1100"}, ","),
+		ShippingRates:             getEnvAsSlice("SHIPPING_RATES", []string{"standard:ID:IDR:15000:5000:500000", "express:ID:IDR:30000:10000:0"}, ","),
+		SellerCommissionRate:      getEnvAsInt("SELLER_COMMISSION_RATE", 0),
+		IdempotencyTTL:            getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		GuestCartTTL:              getEnvAsDuration("GUEST_CART_TTL", 30*24*time.Hour),
+		PaymentNotificationSecret: notificationSecret,
+		JWTSecret:                 jwtSecret,
+		ServiceJWTSecret:          serviceJWTSecret,
+		KafkaGroupID:              getEnv("KAFKA_GROUP_ID", "order-service"),
+		ClientTimeout:             getEnvAsDuration("GRPC_CLIENT_TIMEOUT", 5*time.Second),
+		ClientMaxAttempts:         getEnvAsInt("GRPC_CLIENT_MAX_ATTEMPTS", 3),
+		ClientInitialBackoff:      getEnvAsDuration("GRPC_CLIENT_INITIAL_BACKOFF", 100*time.Millisecond),
+		ClientMaxBackoff:          getEnvAsDuration("GRPC_CLIENT_MAX_BACKOFF", time.Second),
+		ClientHedgingDelay:        getEnvAsDuration("GRPC_CLIENT_HEDGING_DELAY", 50*time.Millisecond),
+		BreakerFailureThreshold:   getEnvAsInt("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerOpenTimeout:        getEnvAsDuration("BREAKER_OPEN_TIMEOUT", 30*time.Second),
+		MetricsAddr:               getEnv("METRICS_ADDR", ":9090"),
 	}, nil
 }
 
@@ -45,3 +133,23 @@ func getEnvAsSlice(key string, defaultValues []string, sep string) []string {
 	}
 	return defaultValues
 }
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+		log.Printf("invalid integer for %s, using default %d", key, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("invalid duration for %s, using default %s", key, defaultValue)
+	}
+	return defaultValue
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+
+	"shared/money"
+)
+
+// Cart holds the items a user or a guest intends to order. Guest carts expire
+// and are merged into the user's cart on login.
+type Cart struct {
+	ID      string     `json:"id" bson:"_id"`
+	UserID  string     `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	GuestID string     `json:"guest_id,omitempty" bson:"guest_id,omitempty"`
+	Items   []CartItem `json:"items" bson:"items"`
+	// MergedCarts names the guest carts merged into this one, so that a
+	// merge retried before the guest cart was deleted adds nothing.
+	MergedCarts []string `json:"-" bson:"merged_carts,omitempty"`
+	// Subtotal is set when the cart is refreshed and its items share a
+	// currency.
+	Subtotal  money.Money `json:"subtotal" bson:"-"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	CreatedAt time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" bson:"updated_at"`
+	// Version is bumped on every save and guards against lost updates.
+	Version int64 `json:"version" bson:"version"`
+}
+
+// CartItem stores the product and quantity only. Name, price and stock are
+// refreshed from the catalog whenever the cart is read.
+type CartItem struct {
+	ProductID string      `json:"product_id" bson:"product_id"`
+	Quantity  int         `json:"quantity" bson:"quantity"`
+	AddedAt   time.Time   `json:"added_at" bson:"added_at"`
+	Name      string      `json:"name" bson:"-"`
+	Price     money.Money `json:"price" bson:"-"`
+	Stock     int         `json:"stock" bson:"-"`
+	// Available is false when the product is gone or has less stock than
+	// Quantity.
+	Available bool `json:"available" bson:"-"`
+}
+
+// Item returns the cart item of the product, or nil.
+func (c *Cart) Item(productID string) *CartItem {
+	for i := range c.Items {
+		if c.Items[i].ProductID == productID {
+			return &c.Items[i]
+		}
+	}
+	return nil
+}
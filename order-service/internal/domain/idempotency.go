@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+)
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyStatusInProgress IdempotencyStatus = "in_progress"
+	IdempotencyStatusCompleted  IdempotencyStatus = "completed"
+)
+
+// IdempotencyRecord remembers the first response to a request made with an
+// idempotency key, so that retries with the same key replay it instead of
+// running the request again.
+type IdempotencyRecord struct {
+	ID          string            `json:"id" bson:"_id"`
+	UserID      string            `json:"user_id" bson:"user_id"`
+	Operation   string            `json:"operation" bson:"operation"`
+	Key         string            `json:"key" bson:"key"`
+	RequestHash string            `json:"request_hash" bson:"request_hash"`
+	Status      IdempotencyStatus `json:"status" bson:"status"`
+	Response    []byte            `json:"response,omitempty" bson:"response,omitempty"`
+	LockedUntil time.Time         `json:"locked_until" bson:"locked_until"`
+	CreatedAt   time.Time         `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at" bson:"expires_at"`
+}
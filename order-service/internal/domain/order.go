@@ -2,48 +2,227 @@ package domain
 
 import (
 	"time"
+
+	"shared/money"
 )
 
 type OrderStatus string
 
 const (
-	OrderStatusPending   OrderStatus = "pending"
-	OrderStatusPaid      OrderStatus = "paid"
-	OrderStatusFailed    OrderStatus = "failed"
-	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusPending        OrderStatus = "pending"
+	OrderStatusPaymentPending OrderStatus = "payment_pending"
+	OrderStatusPaid           OrderStatus = "paid"
+	OrderStatusFailed         OrderStatus = "failed"
+	OrderStatusCancelled      OrderStatus = "cancelled"
+	OrderStatusShipped        OrderStatus = "shipped"
+	OrderStatusDelivered      OrderStatus = "delivered"
+	OrderStatusRefunded       OrderStatus = "refunded"
 )
 
+// Order is what a user bought. SubOrders split it by seller; orders placed
+// before the marketplace have none. Version is bumped on every save and
+// guards against lost updates.
 type Order struct {
-	ID         string      `json:"id" bson:"_id"`
-	UserID     string      `json:"user_id" bson:"user_id"`
-	Items      []OrderItem `json:"items" bson:"items"`
-	Total      float64     `json:"total" bson:"total"`
-	Status     OrderStatus `json:"status" bson:"status"`
-	PaymentID  string      `json:"payment_id,omitempty" bson:"payment_id,omitempty"`
-	PaymentURL string      `json:"payment_url,omitempty" bson:"payment_url,omitempty"`
-	CreatedAt  time.Time   `json:"created_at" bson:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at" bson:"updated_at"`
+	ID              string            `json:"id" bson:"_id"`
+	Version         int64             `json:"version" bson:"version"`
+	UserID          string            `json:"user_id" bson:"user_id"`
+	Items           []OrderItem       `json:"items" bson:"items"`
+	SubOrders       []SubOrder        `json:"sub_orders,omitempty" bson:"sub_orders,omitempty"`
+	Subtotal        money.Money       `json:"subtotal" bson:"subtotal"`
+	Discounts       []AppliedDiscount `json:"discounts,omitempty" bson:"discounts,omitempty"`
+	DiscountTotal   money.Money       `json:"discount_total" bson:"discount_total"`
+	ShippingCost    money.Money       `json:"shipping_cost" bson:"shipping_cost"`
+	ShippingAddress *Address          `json:"shipping_address,omitempty" bson:"shipping_address,omitempty"`
+	BillingAddress  *Address          `json:"billing_address,omitempty" bson:"billing_address,omitempty"`
+	ShippingMethod  string            `json:"shipping_method,omitempty" bson:"shipping_method,omitempty"`
+	Destination     *Destination      `json:"destination,omitempty" bson:"destination,omitempty"`
+	TaxMode         TaxMode           `json:"tax_mode,omitempty" bson:"tax_mode,omitempty"`
+	TaxTotal        money.Money       `json:"tax_total" bson:"tax_total"`
+	Total           money.Money       `json:"total" bson:"total"`
+	Status          OrderStatus       `json:"status" bson:"status"`
+	StatusHistory   []StatusChange    `json:"status_history" bson:"status_history"`
+	PaymentID       string            `json:"payment_id,omitempty" bson:"payment_id,omitempty"`
+	PaymentURL      string            `json:"payment_url,omitempty" bson:"payment_url,omitempty"`
+	ReservationID   string            `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+	PriceMismatch   bool              `json:"price_mismatch,omitempty" bson:"price_mismatch,omitempty"`
+	Refunds         []Refund          `json:"refunds,omitempty" bson:"refunds,omitempty"`
+	RefundedTotal   money.Money       `json:"refunded_total" bson:"refunded_total"`
+	CreatedAt       time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at" bson:"updated_at"`
 }
 
+// OrderItem snapshots the product name and unit price at the time of the order.
 type OrderItem struct {
-	ProductID string  `json:"product_id" bson:"product_id"`
-	Quantity  int     `json:"quantity" bson:"quantity"`
-	Price     float64 `json:"price" bson:"price"`
+	ProductID      string       `json:"product_id" bson:"product_id"`
+	Name           string       `json:"name" bson:"name"`
+	Quantity       int          `json:"quantity" bson:"quantity"`
+	Price          money.Money  `json:"price" bson:"price"`
+	SubmittedPrice *money.Money `json:"submitted_price,omitempty" bson:"submitted_price,omitempty"`
+	// RefundedQuantity is the part of Quantity that has been refunded.
+	RefundedQuantity int `json:"refunded_quantity,omitempty" bson:"refunded_quantity,omitempty"`
+	// Discount is what the order's promotions took off the line.
+	Discount money.Money `json:"discount" bson:"discount"`
+	// TaxCategory is snapshotted from the product. TaxRate is in basis points
+	// and Tax is the tax of the whole line.
+	TaxCategory string      `json:"tax_category,omitempty" bson:"tax_category,omitempty"`
+	TaxRate     int64       `json:"tax_rate,omitempty" bson:"tax_rate,omitempty"`
+	Tax         money.Money `json:"tax" bson:"tax"`
+	// WeightGrams is the unit weight, used for shipping.
+	WeightGrams int `json:"weight_grams,omitempty" bson:"weight_grams,omitempty"`
+	// SellerID is snapshotted from the product and is empty for items sold
+	// by the shop itself.
+	SellerID string `json:"seller_id,omitempty" bson:"seller_id,omitempty"`
+}
+
+type RefundStatus string
+
+const (
+	// RefundStatusPending refunds are recorded on the order before the
+	// payment service pays them back.
+	RefundStatusPending RefundStatus = "pending"
+	RefundStatusPaid    RefundStatus = "paid"
+)
+
+// Refund records money paid back for an order. Its ID is the idempotency key
+// of the refund at the payment service.
+type Refund struct {
+	ID        string       `json:"id" bson:"id"`
+	Items     []RefundItem `json:"items" bson:"items"`
+	Amount    money.Money  `json:"amount" bson:"amount"`
+	Actor     string       `json:"actor" bson:"actor"`
+	Reason    string       `json:"reason,omitempty" bson:"reason,omitempty"`
+	Status    RefundStatus `json:"status" bson:"status"`
+	CreatedAt time.Time    `json:"created_at" bson:"created_at"`
+	// PaymentRefundID is the ID the payment service gave the refund.
+	PaymentRefundID string `json:"payment_refund_id,omitempty" bson:"payment_refund_id,omitempty"`
+	// Cancellation is set on the refund that cancels a paid order once it is
+	// paid back.
+	Cancellation bool `json:"cancellation,omitempty" bson:"cancellation,omitempty"`
+	// Shares split the amount between the sub-orders of the refunded items.
+	Shares []RefundShare `json:"shares,omitempty" bson:"shares,omitempty"`
+}
+
+// RefundShare is the part of a refund taken off a sub-order.
+type RefundShare struct {
+	SubOrderID string      `json:"sub_order_id" bson:"sub_order_id"`
+	Amount     money.Money `json:"amount" bson:"amount"`
+}
+
+func (r *Refund) IsPending() bool {
+	return r.Status == RefundStatusPending
+}
+
+// Refund returns the refund with the given ID, or nil.
+func (o *Order) Refund(id string) *Refund {
+	for i := range o.Refunds {
+		if o.Refunds[i].ID == id {
+			return &o.Refunds[i]
+		}
+	}
+	return nil
+}
+
+// PendingRefunds returns the IDs of the refunds not paid back yet.
+func (o *Order) PendingRefunds() []string {
+	var ids []string
+	for _, refund := range o.Refunds {
+		if refund.IsPending() {
+			ids = append(ids, refund.ID)
+		}
+	}
+	return ids
+}
+
+// Cancelling reports whether a refund cancelling the order is being paid.
+func (o *Order) Cancelling() bool {
+	for _, refund := range o.Refunds {
+		if refund.Cancellation && refund.IsPending() {
+			return true
+		}
+	}
+	return false
+}
+
+// RefundItem is a quantity of an order item being refunded.
+type RefundItem struct {
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+}
+
+// OrderFilter selects a page of orders, newest first. When After is set only
+// orders older than that position are returned.
+type OrderFilter struct {
+	UserID   string
+	Statuses []OrderStatus
+	After    *OrderCursor
+	Limit    int64
+}
+
+// OrderCursor marks the position of the last order of a page.
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        string
 }
 
 // Events
 type OrderCreatedEvent struct {
+	OrderID   string            `json:"order_id"`
+	UserID    string            `json:"user_id"`
+	Items     []OrderItem       `json:"items"`
+	Subtotal  money.Money       `json:"subtotal"`
+	Discounts []AppliedDiscount `json:"discounts,omitempty"`
+	TaxTotal  money.Money       `json:"tax_total"`
+	Shipping  money.Money       `json:"shipping"`
+	Total     money.Money       `json:"total"`
+	SubOrders []SubOrder        `json:"sub_orders"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type PaymentProcessedEvent struct {
+	OrderID    string      `json:"order_id"`
+	PaymentID  string      `json:"payment_id"`
+	Status     string      `json:"status"`
+	Amount     money.Money `json:"amount"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+type OrderRefundedEvent struct {
+	OrderID    string       `json:"order_id"`
+	UserID     string       `json:"user_id"`
+	RefundID   string       `json:"refund_id"`
+	Items      []RefundItem `json:"items"`
+	Amount     money.Money  `json:"amount"`
+	FullRefund bool         `json:"full_refund"`
+	Reason     string       `json:"reason"`
+	RefundedAt time.Time    `json:"refunded_at"`
+}
+
+// OrderExpiredEvent is published when a pending order is cancelled because
+// it was not paid in time.
+type OrderExpiredEvent struct {
 	OrderID   string      `json:"order_id"`
 	UserID    string      `json:"user_id"`
 	Items     []OrderItem `json:"items"`
-	Total     float64     `json:"total"`
-	CreatedAt time.Time   `json:"created_at"`
+	ExpiredAt time.Time   `json:"expired_at"`
 }
 
-type PaymentProcessedEvent struct {
-	OrderID    string    `json:"order_id"`
-	PaymentID  string    `json:"payment_id"`
-	Status     string    `json:"status"`
-	Amount     float64   `json:"amount"`
-	OccurredAt time.Time `json:"occurred_at"`
+// SubOrderStatusChangedEvent is published when a seller moves its sub-order,
+// e.g. ships it.
+type SubOrderStatusChangedEvent struct {
+	OrderID    string      `json:"order_id"`
+	SubOrderID string      `json:"sub_order_id"`
+	SellerID   string      `json:"seller_id"`
+	UserID     string      `json:"user_id"`
+	Status     OrderStatus `json:"status"`
+	Reason     string      `json:"reason,omitempty"`
+	ChangedAt  time.Time   `json:"changed_at"`
+}
+
+type OrderCancelledEvent struct {
+	OrderID     string      `json:"order_id"`
+	UserID      string      `json:"user_id"`
+	Items       []OrderItem `json:"items"`
+	Refunded    bool        `json:"refunded"`
+	Reason      string      `json:"reason"`
+	CancelledAt time.Time   `json:"cancelled_at"`
 }
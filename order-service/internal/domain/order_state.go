@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	ErrSubOrderShipped         = errors.New("a sub-order of the order has already shipped")
+)
+
+// ActorSystem is recorded as the actor of transitions not triggered by a user.
+const ActorSystem = "system"
+
+// orderTransitions lists the statuses each status may move to. Statuses with
+// no entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:        {OrderStatusPaymentPending, OrderStatusPaid, OrderStatusFailed, OrderStatusCancelled},
+	OrderStatusPaymentPending: {OrderStatusPaid, OrderStatusFailed, OrderStatusCancelled},
+	OrderStatusFailed:         {OrderStatusPaymentPending, OrderStatusPaid, OrderStatusFailed, OrderStatusCancelled},
+	OrderStatusPaid:           {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:        {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered:      {OrderStatusRefunded},
+}
+
+// StatusChange is an entry of an order's append-only status history.
+type StatusChange struct {
+	From   OrderStatus `json:"from,omitempty" bson:"from,omitempty"`
+	To     OrderStatus `json:"to" bson:"to"`
+	Actor  string      `json:"actor" bson:"actor"`
+	Reason string      `json:"reason,omitempty" bson:"reason,omitempty"`
+	At     time.Time   `json:"at" bson:"at"`
+}
+
+func (s OrderStatus) IsTerminal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionTo moves the order to the given status and records the change in
+// its history. Sub-orders follow, so they are paid, cancelled or refunded
+// with the order; sub-orders that got further than the order, e.g. delivered
+// before the last seller shipped, stay where they are. The order is left
+// untouched when it or any of its sub-orders cannot make the transition.
+func (o *Order) TransitionTo(to OrderStatus, actor, reason string) error {
+	if err := o.CheckTransition(to); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	o.StatusHistory = append(o.StatusHistory, StatusChange{
+		From:   o.Status,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		At:     now,
+	})
+	o.Status = to
+	o.UpdatedAt = now
+
+	for i := range o.SubOrders {
+		if !o.SubOrders[i].followsOrder(to) {
+			continue
+		}
+		if err := o.SubOrders[i].TransitionTo(to, actor, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckTransition returns why the order cannot move to the given status, or
+// nil when it can. An order cannot be cancelled once any seller shipped.
+func (o *Order) CheckTransition(to OrderStatus) error {
+	if !o.Status.CanTransitionTo(to) {
+		return ErrInvalidStatusTransition
+	}
+	for _, sub := range o.SubOrders {
+		if !sub.followsOrder(to) || sub.Status.CanTransitionTo(to) {
+			continue
+		}
+		if to == OrderStatusCancelled && fulfilmentRank[sub.Status] > fulfilmentRank[OrderStatusPaid] {
+			return ErrSubOrderShipped
+		}
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		want     bool
+	}{
+		{OrderStatusPending, OrderStatusPaymentPending, true},
+		{OrderStatusPending, OrderStatusPaid, true},
+		{OrderStatusPending, OrderStatusShipped, false},
+		{OrderStatusPaymentPending, OrderStatusPaid, true},
+		{OrderStatusPaymentPending, OrderStatusPending, false},
+		{OrderStatusFailed, OrderStatusPaymentPending, true},
+		{OrderStatusFailed, OrderStatusFailed, true},
+		{OrderStatusPaid, OrderStatusShipped, true},
+		{OrderStatusPaid, OrderStatusCancelled, true},
+		{OrderStatusPaid, OrderStatusPending, false},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusDelivered, OrderStatusRefunded, true},
+		{OrderStatusDelivered, OrderStatusShipped, false},
+		{OrderStatusCancelled, OrderStatusPaid, false},
+		{OrderStatusRefunded, OrderStatusPaid, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("CanTransitionTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	tests := []struct {
+		status OrderStatus
+		want   bool
+	}{
+		{OrderStatusPending, false},
+		{OrderStatusPaid, false},
+		{OrderStatusDelivered, false},
+		{OrderStatusCancelled, true},
+		{OrderStatusRefunded, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.IsTerminal(); got != tt.want {
+				t.Errorf("IsTerminal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderTransitionTo(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      OrderStatus
+		subOrders   []OrderStatus
+		to          OrderStatus
+		wantErr     error
+		wantStatus  OrderStatus
+		wantSubs    []OrderStatus
+		wantHistory int
+	}{
+		{
+			name:        "pending order is paid",
+			status:      OrderStatusPending,
+			to:          OrderStatusPaid,
+			wantStatus:  OrderStatusPaid,
+			wantHistory: 1,
+		},
+		{
+			name:       "invalid transition leaves the order",
+			status:     OrderStatusCancelled,
+			to:         OrderStatusPaid,
+			wantErr:    ErrInvalidStatusTransition,
+			wantStatus: OrderStatusCancelled,
+		},
+		{
+			name:        "sub-orders follow payment",
+			status:      OrderStatusPending,
+			subOrders:   []OrderStatus{OrderStatusPending, OrderStatusPending},
+			to:          OrderStatusPaid,
+			wantStatus:  OrderStatusPaid,
+			wantSubs:    []OrderStatus{OrderStatusPaid, OrderStatusPaid},
+			wantHistory: 1,
+		},
+		{
+			name:        "unshipped sub-orders are cancelled",
+			status:      OrderStatusPaid,
+			subOrders:   []OrderStatus{OrderStatusPaid, OrderStatusPaid},
+			to:          OrderStatusCancelled,
+			wantStatus:  OrderStatusCancelled,
+			wantSubs:    []OrderStatus{OrderStatusCancelled, OrderStatusCancelled},
+			wantHistory: 1,
+		},
+		{
+			name:       "shipped sub-order blocks cancellation",
+			status:     OrderStatusPaid,
+			subOrders:  []OrderStatus{OrderStatusPaid, OrderStatusShipped},
+			to:         OrderStatusCancelled,
+			wantErr:    ErrSubOrderShipped,
+			wantStatus: OrderStatusPaid,
+			wantSubs:   []OrderStatus{OrderStatusPaid, OrderStatusShipped},
+		},
+		{
+			name:        "delivered sub-order stays when the order ships",
+			status:      OrderStatusPaid,
+			subOrders:   []OrderStatus{OrderStatusShipped, OrderStatusDelivered},
+			to:          OrderStatusShipped,
+			wantStatus:  OrderStatusShipped,
+			wantSubs:    []OrderStatus{OrderStatusShipped, OrderStatusDelivered},
+			wantHistory: 1,
+		},
+		{
+			name:        "every sub-order is refunded",
+			status:      OrderStatusDelivered,
+			subOrders:   []OrderStatus{OrderStatusDelivered, OrderStatusDelivered},
+			to:          OrderStatusRefunded,
+			wantStatus:  OrderStatusRefunded,
+			wantSubs:    []OrderStatus{OrderStatusRefunded, OrderStatusRefunded},
+			wantHistory: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{Status: tt.status}
+			for _, status := range tt.subOrders {
+				order.SubOrders = append(order.SubOrders, SubOrder{Status: status})
+			}
+
+			err := order.TransitionTo(tt.to, ActorSystem, "test")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionTo() error = %v, want %v", err, tt.wantErr)
+			}
+			if order.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", order.Status, tt.wantStatus)
+			}
+			if len(order.StatusHistory) != tt.wantHistory {
+				t.Errorf("len(StatusHistory) = %d, want %d", len(order.StatusHistory), tt.wantHistory)
+			}
+			for i, want := range tt.wantSubs {
+				if got := order.SubOrders[i].Status; got != want {
+					t.Errorf("SubOrders[%d].Status = %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransitionSubOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     OrderStatus
+		subOrders  []OrderStatus
+		cancelling bool
+		to         OrderStatus
+		wantErr    error
+		wantStatus OrderStatus
+	}{
+		{
+			name:       "order waits for the other seller",
+			subOrders:  []OrderStatus{OrderStatusPaid, OrderStatusPaid},
+			to:         OrderStatusShipped,
+			wantStatus: OrderStatusPaid,
+		},
+		{
+			name:       "last seller ships the order",
+			subOrders:  []OrderStatus{OrderStatusPaid, OrderStatusShipped},
+			to:         OrderStatusShipped,
+			wantStatus: OrderStatusShipped,
+		},
+		{
+			name:       "last parcel delivers the order",
+			status:     OrderStatusShipped,
+			subOrders:  []OrderStatus{OrderStatusShipped, OrderStatusDelivered},
+			to:         OrderStatusDelivered,
+			wantStatus: OrderStatusDelivered,
+		},
+		{
+			name:       "nothing ships while cancelling",
+			subOrders:  []OrderStatus{OrderStatusPaid, OrderStatusPaid},
+			cancelling: true,
+			to:         OrderStatusShipped,
+			wantErr:    ErrOrderCancelling,
+			wantStatus: OrderStatusPaid,
+		},
+		{
+			name:       "sub-order cannot skip shipping",
+			subOrders:  []OrderStatus{OrderStatusPaid, OrderStatusPaid},
+			to:         OrderStatusDelivered,
+			wantErr:    ErrInvalidStatusTransition,
+			wantStatus: OrderStatusPaid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{Status: OrderStatusPaid}
+			if tt.status != "" {
+				order.Status = tt.status
+			}
+			for i, status := range tt.subOrders {
+				order.SubOrders = append(order.SubOrders, SubOrder{ID: string(rune('a' + i)), Status: status})
+			}
+			if tt.cancelling {
+				order.Refunds = []Refund{{Cancellation: true, Status: RefundStatusPending}}
+			}
+
+			err := order.TransitionSubOrder("a", tt.to, "seller", "test")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionSubOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if order.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", order.Status, tt.wantStatus)
+			}
+		})
+	}
+}
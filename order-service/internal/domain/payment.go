@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"time"
+
+	"shared/money"
+	"shared/signature"
+)
+
+// Payment statuses reported by the payment service. Redirect based gateways
+// answer a charge with PaymentStatusPending and report the outcome later
+// through a PaymentNotification.
+const (
+	PaymentStatusSuccess  = "success"
+	PaymentStatusPending  = "pending"
+	PaymentStatusFailed   = "failed"
+	PaymentStatusRefunded = "refunded"
+)
+
+// PaymentNotification is a signed report of a payment status change sent by
+// the payment service.
+type PaymentNotification struct {
+	PaymentID  string      `json:"payment_id"`
+	OrderID    string      `json:"order_id"`
+	Status     string      `json:"status"`
+	Amount     money.Money `json:"amount"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Signature  string      `json:"signature"`
+}
+
+// SignedPayload returns the content covered by the notification signature.
+func (n PaymentNotification) SignedPayload() string {
+	return signature.PaymentNotificationPayload(n.PaymentID, n.OrderID, n.Status, n.Amount, n.OccurredAt)
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"time"
+
+	"shared/money"
+)
+
+type PromotionType string
+
+const (
+	// PromotionPercentage takes PercentOff percent off the eligible items.
+	PromotionPercentage PromotionType = "percentage"
+	// PromotionFixed takes AmountOff off the eligible items.
+	PromotionFixed PromotionType = "fixed"
+	// PromotionBuyXGetY makes GetQuantity units free out of every
+	// BuyQuantity+GetQuantity units of an eligible item.
+	PromotionBuyXGetY PromotionType = "buy_x_get_y"
+)
+
+// Promotion is a discount applied automatically to every qualifying order,
+// or only to orders that submit its Code when it has one.
+type Promotion struct {
+	ID          string        `json:"id" bson:"_id"`
+	Code        string        `json:"code,omitempty" bson:"code,omitempty"`
+	Name        string        `json:"name" bson:"name"`
+	Type        PromotionType `json:"type" bson:"type"`
+	PercentOff  int64         `json:"percent_off,omitempty" bson:"percent_off,omitempty"`
+	AmountOff   money.Money   `json:"amount_off" bson:"amount_off"`
+	BuyQuantity int           `json:"buy_quantity,omitempty" bson:"buy_quantity,omitempty"`
+	GetQuantity int           `json:"get_quantity,omitempty" bson:"get_quantity,omitempty"`
+	// ProductIDs restricts the promotion to these products. Empty means every
+	// product is eligible.
+	ProductIDs []string `json:"product_ids,omitempty" bson:"product_ids,omitempty"`
+	// MinSpend is the order subtotal required for the promotion to apply.
+	// A zero amount means no minimum.
+	MinSpend money.Money `json:"min_spend" bson:"min_spend"`
+	// PerUserLimit and TotalLimit cap the orders using the promotion. Zero
+	// means unlimited.
+	PerUserLimit int       `json:"per_user_limit,omitempty" bson:"per_user_limit,omitempty"`
+	TotalLimit   int       `json:"total_limit,omitempty" bson:"total_limit,omitempty"`
+	Uses         int       `json:"uses" bson:"uses"`
+	StartsAt     time.Time `json:"starts_at" bson:"starts_at"`
+	// EndsAt is exclusive. A zero time means the promotion never ends.
+	EndsAt    time.Time `json:"ends_at" bson:"ends_at"`
+	Active    bool      `json:"active" bson:"active"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// IsLive reports whether the promotion can be used at t.
+func (p *Promotion) IsLive(t time.Time) bool {
+	if !p.Active || t.Before(p.StartsAt) {
+		return false
+	}
+	if !p.EndsAt.IsZero() && !t.Before(p.EndsAt) {
+		return false
+	}
+	return p.TotalLimit == 0 || p.Uses < p.TotalLimit
+}
+
+// AppliesTo reports whether the product is eligible for the promotion.
+func (p *Promotion) AppliesTo(productID string) bool {
+	if len(p.ProductIDs) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliedDiscount itemizes a promotion applied to an order.
+type AppliedDiscount struct {
+	PromotionID string      `json:"promotion_id" bson:"promotion_id"`
+	Code        string      `json:"code,omitempty" bson:"code,omitempty"`
+	Name        string      `json:"name" bson:"name"`
+	Amount      money.Money `json:"amount" bson:"amount"`
+}
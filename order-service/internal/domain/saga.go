@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+)
+
+type SagaStatus string
+
+const (
+	SagaStatusRunning      SagaStatus = "running"
+	SagaStatusCompensating SagaStatus = "compensating"
+	// SagaStatusAwaitingPayment sagas wait at the charge step for the payment
+	// notification of a redirect based gateway.
+	SagaStatusAwaitingPayment SagaStatus = "awaiting_payment"
+	SagaStatusCompleted       SagaStatus = "completed"
+	SagaStatusCompensated     SagaStatus = "compensated"
+)
+
+type SagaStep string
+
+const (
+	SagaStepReserveStock SagaStep = "reserve_stock"
+	SagaStepCharge       SagaStep = "charge"
+	SagaStepConfirm      SagaStep = "confirm"
+	SagaStepPublish      SagaStep = "publish"
+)
+
+// CheckoutSaga is the persisted state of a checkout. It is saved after every
+// step so that a checkout interrupted by a crash can be resumed or
+// compensated from where it stopped.
+type CheckoutSaga struct {
+	ID             string     `json:"id" bson:"_id"`
+	OrderID        string     `json:"order_id" bson:"order_id"`
+	PaymentMethod  string     `json:"payment_method" bson:"payment_method"`
+	Status         SagaStatus `json:"status" bson:"status"`
+	Active         bool       `json:"active" bson:"active"`
+	CurrentStep    SagaStep   `json:"current_step" bson:"current_step"`
+	CompletedSteps []SagaStep `json:"completed_steps" bson:"completed_steps"`
+	Attempts       int        `json:"attempts" bson:"attempts"`
+	PaymentID      string     `json:"payment_id,omitempty" bson:"payment_id,omitempty"`
+	PaymentURL     string     `json:"payment_url,omitempty" bson:"payment_url,omitempty"`
+	PaymentStatus  string     `json:"payment_status,omitempty" bson:"payment_status,omitempty"`
+	StockCommitted bool       `json:"stock_committed" bson:"stock_committed"`
+	LastError      string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+func (s SagaStatus) IsFinished() bool {
+	return s == SagaStatusCompleted || s == SagaStatusCompensated
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"strings"
+
+	"shared/money"
+)
+
+// Address is a postal address used for shipping or billing.
+type Address struct {
+	Name       string `json:"name" bson:"name"`
+	Phone      string `json:"phone,omitempty" bson:"phone,omitempty"`
+	Line1      string `json:"line1" bson:"line1"`
+	Line2      string `json:"line2,omitempty" bson:"line2,omitempty"`
+	City       string `json:"city" bson:"city"`
+	Region     string `json:"region,omitempty" bson:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty" bson:"postal_code,omitempty"`
+	// Country is an ISO 3166-1 alpha-2 code, e.g. "ID".
+	Country string `json:"country" bson:"country"`
+}
+
+// IsComplete reports whether the address has the fields a carrier needs.
+func (a *Address) IsComplete() bool {
+	return strings.TrimSpace(a.Name) != "" &&
+		strings.TrimSpace(a.Line1) != "" &&
+		strings.TrimSpace(a.City) != "" &&
+		strings.TrimSpace(a.Country) != ""
+}
+
+// Destination returns the country and region the address is in.
+func (a *Address) Destination() *Destination {
+	return &Destination{Country: a.Country, Region: a.Region}
+}
+
+// Delivery is how an order is shipped and billed. Orders without a shipping
+// address, e.g. of digital goods, are not shipped and may give a Destination
+// for tax instead.
+type Delivery struct {
+	ShippingAddress *Address
+	// BillingAddress defaults to the shipping address.
+	BillingAddress *Address
+	// ShippingMethod is a method of the shipping rates, e.g. "standard".
+	ShippingMethod string
+	Destination    *Destination
+}
+
+// ShippingRate prices a shipping method to a zone: Base per order plus PerKg
+// for every started kilogram, free from a FreeOver order amount.
+type ShippingRate struct {
+	Method string
+	// Zone is a country ("ID"), a region of a country ("ID-JK") or empty for
+	// everywhere.
+	Zone     string
+	Base     money.Money
+	PerKg    money.Money
+	FreeOver money.Money
+}
@@ -0,0 +1,148 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"shared/money"
+)
+
+var (
+	ErrSubOrderNotFound = errors.New("sub-order not found")
+	ErrOrderCancelling  = errors.New("order is being cancelled")
+)
+
+// SubOrder is the part of an order sold and shipped by one seller. The buyer
+// pays the order as a whole; each seller fulfils its sub-order and is paid
+// out its total less the marketplace commission. Items belong to the
+// sub-order of their SellerID. Refunds are taken off the sub-orders of the
+// refunded items, reducing their payout.
+type SubOrder struct {
+	ID       string `json:"id" bson:"id"`
+	SellerID string `json:"seller_id" bson:"seller_id"`
+	// Subtotal, DiscountTotal and TaxTotal are the seller's share of the
+	// order amounts.
+	Subtotal      money.Money    `json:"subtotal" bson:"subtotal"`
+	DiscountTotal money.Money    `json:"discount_total" bson:"discount_total"`
+	TaxTotal      money.Money    `json:"tax_total" bson:"tax_total"`
+	ShippingCost  money.Money    `json:"shipping_cost" bson:"shipping_cost"`
+	Total         money.Money    `json:"total" bson:"total"`
+	Commission    money.Money    `json:"commission" bson:"commission"`
+	Payout        money.Money    `json:"payout" bson:"payout"`
+	RefundedTotal money.Money    `json:"refunded_total" bson:"refunded_total"`
+	Status        OrderStatus    `json:"status" bson:"status"`
+	StatusHistory []StatusChange `json:"status_history" bson:"status_history"`
+	UpdatedAt     time.Time      `json:"updated_at" bson:"updated_at"`
+}
+
+// TransitionTo moves the sub-order to the given status and records the change
+// in its history. Sub-orders follow the same transitions as orders.
+func (s *SubOrder) TransitionTo(to OrderStatus, actor, reason string) error {
+	if !s.Status.CanTransitionTo(to) {
+		return ErrInvalidStatusTransition
+	}
+
+	now := time.Now()
+	s.StatusHistory = append(s.StatusHistory, StatusChange{
+		From:   s.Status,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		At:     now,
+	})
+	s.Status = to
+	s.UpdatedAt = now
+	return nil
+}
+
+// followsOrder reports whether the sub-order makes the order's transition to
+// the given status. A sub-order that already shipped or was delivered does
+// not follow the order to the same or an earlier fulfilment status.
+func (s *SubOrder) followsOrder(to OrderStatus) bool {
+	rank, fulfilling := fulfilmentRank[s.Status]
+	toRank, fulfilment := fulfilmentRank[to]
+	return !fulfilling || !fulfilment || rank < toRank
+}
+
+// ApplyRefund takes an amount paid back to the buyer off the sub-order. The
+// seller's payout drops by the amount less the commission charged on it.
+func (s *SubOrder) ApplyRefund(amount money.Money) error {
+	commission := money.Zero(amount.Currency)
+	if s.Total.Amount > 0 {
+		commission = s.Commission.MulRatio(amount.Amount, s.Total.Amount)
+	}
+	payout, err := amount.Sub(commission)
+	if err != nil {
+		return err
+	}
+
+	refundedTotal := s.RefundedTotal
+	if refundedTotal.Currency == "" {
+		refundedTotal = money.Zero(amount.Currency)
+	}
+	if s.RefundedTotal, err = refundedTotal.Add(amount); err != nil {
+		return err
+	}
+	if s.Commission, err = s.Commission.Sub(commission); err != nil {
+		return err
+	}
+	if s.Payout, err = s.Payout.Sub(payout); err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// SubOrder returns the sub-order with the given ID, or nil.
+func (o *Order) SubOrder(id string) *SubOrder {
+	for i := range o.SubOrders {
+		if o.SubOrders[i].ID == id {
+			return &o.SubOrders[i]
+		}
+	}
+	return nil
+}
+
+// fulfilmentRank orders the statuses a paid sub-order moves through.
+var fulfilmentRank = map[OrderStatus]int{
+	OrderStatusPaid:      0,
+	OrderStatusShipped:   1,
+	OrderStatusDelivered: 2,
+}
+
+// TransitionSubOrder moves one sub-order, e.g. when its seller ships it. The
+// order follows once all of its sub-orders got at least as far: it is shipped
+// when every seller shipped and delivered when every parcel arrived. Nothing
+// ships while the order is being cancelled.
+func (o *Order) TransitionSubOrder(id string, to OrderStatus, actor, reason string) error {
+	sub := o.SubOrder(id)
+	if sub == nil {
+		return ErrSubOrderNotFound
+	}
+	if to == OrderStatusShipped && o.Cancelling() {
+		return ErrOrderCancelling
+	}
+	if err := sub.TransitionTo(to, actor, reason); err != nil {
+		return err
+	}
+	o.UpdatedAt = sub.UpdatedAt
+
+	least := OrderStatusDelivered
+	for _, s := range o.SubOrders {
+		rank, ok := fulfilmentRank[s.Status]
+		if !ok {
+			return nil
+		}
+		if rank < fulfilmentRank[least] {
+			least = s.Status
+		}
+	}
+	for _, next := range []OrderStatus{OrderStatusShipped, OrderStatusDelivered} {
+		if fulfilmentRank[next] <= fulfilmentRank[least] && o.Status.CanTransitionTo(next) {
+			if err := o.TransitionTo(next, actor, reason); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
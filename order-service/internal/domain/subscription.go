@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"shared/money"
+)
+
+var ErrInvalidSchedule = errors.New("invalid subscription schedule")
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive    SubscriptionStatus = "active"
+	SubscriptionStatusPaused    SubscriptionStatus = "paused"
+	SubscriptionStatusCancelled SubscriptionStatus = "cancelled"
+)
+
+type ScheduleUnit string
+
+const (
+	ScheduleUnitDay   ScheduleUnit = "day"
+	ScheduleUnitWeek  ScheduleUnit = "week"
+	ScheduleUnitMonth ScheduleUnit = "month"
+)
+
+// Schedule repeats every Every units, e.g. every 1 month.
+type Schedule struct {
+	Unit  ScheduleUnit `json:"unit" bson:"unit"`
+	Every int          `json:"every" bson:"every"`
+}
+
+func (s Schedule) Validate() error {
+	switch s.Unit {
+	case ScheduleUnitDay, ScheduleUnitWeek, ScheduleUnitMonth:
+	default:
+		return ErrInvalidSchedule
+	}
+	if s.Every <= 0 {
+		return ErrInvalidSchedule
+	}
+	return nil
+}
+
+// Next returns the run after t. Monthly runs on a day the next month lacks
+// move to its last day.
+func (s Schedule) Next(t time.Time) time.Time {
+	switch s.Unit {
+	case ScheduleUnitWeek:
+		return t.AddDate(0, 0, 7*s.Every)
+	case ScheduleUnitMonth:
+		next := t.AddDate(0, s.Every, 0)
+		// AddDate turns e.g. January 31 into March 3
+		if next.Day() != t.Day() {
+			next = next.AddDate(0, 0, -next.Day())
+		}
+		return next
+	}
+	return t.AddDate(0, 0, s.Every)
+}
+
+// Subscription places the same order on a schedule and pays it with a saved
+// payment method.
+type Subscription struct {
+	ID       string             `json:"id" bson:"_id"`
+	UserID   string             `json:"user_id" bson:"user_id"`
+	Items    []SubscriptionItem `json:"items" bson:"items"`
+	Currency money.Currency     `json:"currency,omitempty" bson:"currency,omitempty"`
+	Schedule Schedule           `json:"schedule" bson:"schedule"`
+	// NextRunAt is when the next order is placed.
+	NextRunAt       time.Time `json:"next_run_at" bson:"next_run_at"`
+	ShippingAddress *Address  `json:"shipping_address,omitempty" bson:"shipping_address,omitempty"`
+	BillingAddress  *Address  `json:"billing_address,omitempty" bson:"billing_address,omitempty"`
+	ShippingMethod  string    `json:"shipping_method,omitempty" bson:"shipping_method,omitempty"`
+	// PaymentMethod is the saved payment method the orders are charged to.
+	PaymentMethod string             `json:"payment_method" bson:"payment_method"`
+	Status        SubscriptionStatus `json:"status" bson:"status"`
+	// PauseReason tells why a paused subscription stopped, e.g. because its
+	// payments kept failing.
+	PauseReason string `json:"pause_reason,omitempty" bson:"pause_reason,omitempty"`
+	// PendingOrderID is the order of the current run until it is paid.
+	// Failed payments are retried at RetryAt.
+	PendingOrderID  string     `json:"pending_order_id,omitempty" bson:"pending_order_id,omitempty"`
+	PaymentAttempts int        `json:"payment_attempts,omitempty" bson:"payment_attempts,omitempty"`
+	RetryAt         *time.Time `json:"retry_at,omitempty" bson:"retry_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	LastOrderID     string     `json:"last_order_id,omitempty" bson:"last_order_id,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" bson:"updated_at"`
+	// Version is bumped on every save and guards against lost updates.
+	Version int64 `json:"version" bson:"version"`
+}
+
+type SubscriptionItem struct {
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+}
+
+// Delivery returns how the orders of the subscription are shipped and billed.
+func (s *Subscription) Delivery() Delivery {
+	return Delivery{
+		ShippingAddress: s.ShippingAddress,
+		BillingAddress:  s.BillingAddress,
+		ShippingMethod:  s.ShippingMethod,
+	}
+}
+
+// SkipTo moves the next run to the first scheduled run after t.
+func (s *Subscription) SkipTo(t time.Time) {
+	for !s.NextRunAt.After(t) {
+		s.NextRunAt = s.Schedule.Next(s.NextRunAt)
+	}
+}
+
+// SubscriptionPaymentFailedEvent is published when a subscription is paused
+// because the payment of its order kept failing.
+type SubscriptionPaymentFailedEvent struct {
+	SubscriptionID string    `json:"subscription_id"`
+	UserID         string    `json:"user_id"`
+	OrderID        string    `json:"order_id"`
+	Attempts       int       `json:"attempts"`
+	Reason         string    `json:"reason"`
+	FailedAt       time.Time `json:"failed_at"`
+}
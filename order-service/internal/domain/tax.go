@@ -0,0 +1,32 @@
+package domain
+
+// TaxMode says whether catalog prices already include tax.
+type TaxMode string
+
+const (
+	// TaxExclusive adds the tax on top of the prices, so it is part of the
+	// order total.
+	TaxExclusive TaxMode = "exclusive"
+	// TaxInclusive takes the tax out of the prices, as with Indonesian PPN on
+	// consumer prices. The total does not change.
+	TaxInclusive TaxMode = "inclusive"
+)
+
+// Destination is where an order is shipped to, which decides its tax rates.
+type Destination struct {
+	// Country is an ISO 3166-1 alpha-2 code, e.g. "ID".
+	Country string `json:"country" bson:"country"`
+	// Region is optional, e.g. a province or state code.
+	Region string `json:"region,omitempty" bson:"region,omitempty"`
+}
+
+// TaxRate is the rate, in basis points, charged on products of a tax category
+// shipped to a country or region. An empty Region matches the whole country
+// and an empty Category matches every category.
+type TaxRate struct {
+	Country  string
+	Region   string
+	Category string
+	// BasisPoints is the rate in hundredths of a percent, e.g. 1100 for 11%.
+	BasisPoints int64
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+
+	"shared/auth"
+)
+
+// MethodAccess lists the methods that do not need a user token. Payment
+// notifications are signed by the payment service instead, and guests keep a
+// cart before they log in.
+var MethodAccess = map[string]auth.Access{
+	"/order.OrderService/HandlePaymentNotification": auth.AccessPublic,
+	"/order.OrderService/GetCart":                   auth.AccessPublic,
+	"/order.OrderService/AddCartItem":               auth.AccessPublic,
+	"/order.OrderService/UpdateCartItem":            auth.AccessPublic,
+	"/order.OrderService/RemoveCartItem":            auth.AccessPublic,
+	"/order.OrderService/CreatePromotion":           auth.AccessAdmin,
+	"/order.OrderService/RefundOrder":               auth.AccessAdmin,
+}
+
+// callerID returns the user a request acts for: the caller, or the user named
+// in the request when the caller is an admin.
+func callerID(ctx context.Context, requested string) (string, error) {
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return "", auth.ErrUnauthenticated
+	}
+	if requested == "" || requested == claims.UserID {
+		return claims.UserID, nil
+	}
+	if !auth.IsPrivileged(claims) {
+		return "", auth.ErrPermissionDenied
+	}
+	return requested, nil
+}
+
+// cartOwner returns the owner of the cart a request acts on. Guests name their
+// cart by guest ID and need no token, user carts are those of the caller.
+func cartOwner(ctx context.Context, userID, guestID string) (string, string, error) {
+	if userID == "" && guestID != "" {
+		return "", guestID, nil
+	}
+	userID, err := callerID(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	return userID, "", nil
+}
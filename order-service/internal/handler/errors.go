@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"order-service/internal/domain"
+	"order-service/internal/repository"
+	"order-service/internal/service"
+	"shared/auth"
+	"shared/money"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain identifies this service in google.rpc.ErrorInfo details.
+const errorDomain = "order-service"
+
+type errorMapping struct {
+	err    error
+	code   codes.Code
+	reason string
+}
+
+// errorMappings is checked in order, the first matching error wins.
+var errorMappings = []errorMapping{
+	{service.ErrOrderNotFound, codes.NotFound, "ORDER_NOT_FOUND"},
+	{domain.ErrSubOrderNotFound, codes.NotFound, "SUB_ORDER_NOT_FOUND"},
+	{service.ErrSubscriptionNotFound, codes.NotFound, "SUBSCRIPTION_NOT_FOUND"},
+	{service.ErrUnknownPayment, codes.NotFound, "UNKNOWN_PAYMENT"},
+	{service.ErrInvalidOrder, codes.InvalidArgument, "INVALID_ORDER"},
+	{service.ErrInvalidPageToken, codes.InvalidArgument, "INVALID_PAGE_TOKEN"},
+	{service.ErrInvalidRefund, codes.InvalidArgument, "INVALID_REFUND"},
+	{service.ErrPriceMismatch, codes.InvalidArgument, "PRICE_MISMATCH"},
+	{service.ErrCurrencyMismatch, codes.InvalidArgument, "CURRENCY_MISMATCH"},
+	{service.ErrPaymentAmountMismatch, codes.InvalidArgument, "PAYMENT_AMOUNT_MISMATCH"},
+	{service.ErrIdempotencyKeyReused, codes.InvalidArgument, "IDEMPOTENCY_KEY_REUSED"},
+	{service.ErrInvalidCoupon, codes.InvalidArgument, "INVALID_COUPON"},
+	{service.ErrInvalidPromotion, codes.InvalidArgument, "INVALID_PROMOTION"},
+	{service.ErrInvalidAddress, codes.InvalidArgument, "INVALID_ADDRESS"},
+	{service.ErrInvalidCart, codes.InvalidArgument, "INVALID_CART"},
+	{service.ErrInvalidSubscription, codes.InvalidArgument, "INVALID_SUBSCRIPTION"},
+	{domain.ErrInvalidSchedule, codes.InvalidArgument, "INVALID_SCHEDULE"},
+	{repository.ErrPromotionCodeTaken, codes.AlreadyExists, "PROMOTION_CODE_TAKEN"},
+	{money.ErrUnsupportedCurrency, codes.InvalidArgument, "UNSUPPORTED_CURRENCY"},
+	{money.ErrCurrencyMismatch, codes.InvalidArgument, "CURRENCY_MISMATCH"},
+	{service.ErrInvalidSignature, codes.Unauthenticated, "INVALID_SIGNATURE"},
+	{auth.ErrUnauthenticated, codes.Unauthenticated, "UNAUTHENTICATED"},
+	{auth.ErrPermissionDenied, codes.PermissionDenied, "PERMISSION_DENIED"},
+	{service.ErrNotOrderOwner, codes.PermissionDenied, "NOT_ORDER_OWNER"},
+	{service.ErrNotSubOrderSeller, codes.PermissionDenied, "NOT_SUB_ORDER_SELLER"},
+	{service.ErrNotSubscriber, codes.PermissionDenied, "NOT_SUBSCRIBER"},
+	{service.ErrProductValidation, codes.FailedPrecondition, "PRODUCT_UNAVAILABLE"},
+	{service.ErrStockReservation, codes.FailedPrecondition, "INSUFFICIENT_STOCK"},
+	{domain.ErrInvalidStatusTransition, codes.FailedPrecondition, "INVALID_STATUS_TRANSITION"},
+	{domain.ErrSubOrderShipped, codes.FailedPrecondition, "SUB_ORDER_SHIPPED"},
+	{domain.ErrOrderCancelling, codes.FailedPrecondition, "ORDER_CANCELLING"},
+	{service.ErrCouponNotApplicable, codes.FailedPrecondition, "COUPON_NOT_APPLICABLE"},
+	{service.ErrPromotionUsedUp, codes.FailedPrecondition, "PROMOTION_USED_UP"},
+	{service.ErrShippingUnavailable, codes.FailedPrecondition, "SHIPPING_UNAVAILABLE"},
+	{service.ErrEmptyCart, codes.FailedPrecondition, "EMPTY_CART"},
+	{service.ErrSubscriptionStateInvalid, codes.FailedPrecondition, "INVALID_SUBSCRIPTION_STATUS"},
+	{service.ErrCheckoutInProgress, codes.Aborted, "CHECKOUT_IN_PROGRESS"},
+	{service.ErrRequestInProgress, codes.Aborted, "REQUEST_IN_PROGRESS"},
+	{repository.ErrConflict, codes.Aborted, "CONCURRENT_UPDATE"},
+	{service.ErrProductUnavailable, codes.Unavailable, "PRODUCT_SERVICE_UNAVAILABLE"},
+	{service.ErrPaymentProcessing, codes.Unavailable, "PAYMENT_PROCESSING_FAILED"},
+	{service.ErrRefundProcessing, codes.Unavailable, "REFUND_PROCESSING_FAILED"},
+}
+
+// ErrorInterceptor turns the errors returned by the handlers into gRPC
+// statuses with google.rpc error details.
+func ErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return resp, nil
+}
+
+// ErrorStreamInterceptor is the ErrorInterceptor of streaming RPCs.
+func ErrorStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := handler(srv, ss); err != nil {
+		return toStatusError(err)
+	}
+	return nil
+}
+
+func toStatusError(err error) error {
+	for _, m := range errorMappings {
+		if !errors.Is(err, m.err) {
+			continue
+		}
+
+		details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: m.reason, Domain: errorDomain}}
+		var productErr *service.ProductError
+		if errors.As(err, &productErr) && len(productErr.ProductIDs) > 0 {
+			failure := &errdetails.PreconditionFailure{}
+			for _, id := range productErr.ProductIDs {
+				failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+					Type:        m.reason,
+					Subject:     id,
+					Description: productErr.Err.Error(),
+				})
+			}
+			details = append(details, failure)
+		}
+
+		st := status.New(m.code, err.Error())
+		if withDetails, detailsErr := st.WithDetails(details...); detailsErr == nil {
+			st = withDetails
+		}
+		return st.Err()
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -3,12 +3,21 @@ package handler
 import (
 	"context"
 	"log"
+	"time"
 
 	"order-service/gen/order"
 	"order-service/internal/domain"
 	"order-service/internal/service"
+	"shared/money"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// idempotencyKeyHeader lets clients send the idempotency key as gRPC metadata
+// instead of in the request message.
+const idempotencyKeyHeader = "idempotency-key"
+
 type OrderGRPCHandler struct {
 	order.UnimplementedOrderServiceServer
 	service *service.OrderService
@@ -22,17 +31,32 @@ func NewOrderGRPCHandler(svc *service.OrderService) *OrderGRPCHandler {
 
 func (h *OrderGRPCHandler) CreateOrder(ctx context.Context, req *order.CreateOrderRequest) (*order.OrderResponse, error) {
 	// Convert request to domain objects
+	userID, err := callerID(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var currency money.Currency
+	if req.Currency != "" {
+		currency, err = money.ParseCurrency(req.Currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var items []domain.OrderItem
 	for _, item := range req.Items {
 		items = append(items, domain.OrderItem{
 			ProductID: item.ProductId,
 			Quantity:  int(item.Quantity),
-			Price:     item.Price,
+			Price:     fromMoneyProto(item.Price),
 		})
 	}
 
+	delivery := toDelivery(req.ShippingAddress, req.BillingAddress, req.ShippingMethod, req.Destination)
+
 	// Call service
-	order, err := h.service.CreateOrder(ctx, req.UserId, items)
+	o, err := h.service.CreateOrder(ctx, userID, currency, items, delivery, req.CouponCode, idempotencyKey(ctx, req.IdempotencyKey))
 	if err != nil {
 		log.Printf("CreateOrder failed: %v", err)
 		return nil, err
@@ -40,15 +64,22 @@ func (h *OrderGRPCHandler) CreateOrder(ctx context.Context, req *order.CreateOrd
 
 	// Convert response
 	return &order.OrderResponse{
-		OrderId: order.ID,
-		Status:  string(order.Status),
-		Total:   order.Total,
+		OrderId:       o.ID,
+		Status:        string(o.Status),
+		Total:         toMoneyProto(o.Total),
+		Subtotal:      toMoneyProto(o.Subtotal),
+		DiscountTotal: toMoneyProto(o.DiscountTotal),
+		TaxMode:       string(o.TaxMode),
+		TaxTotal:      toMoneyProto(o.TaxTotal),
+		Items:         toOrderItemsProto(o.Items),
+		ShippingCost:  toMoneyProto(o.ShippingCost),
+		SubOrders:     toSubOrdersProto(o.SubOrders),
 	}, nil
 }
 
 func (h *OrderGRPCHandler) ProcessPayment(ctx context.Context, req *order.PaymentRequest) (*order.PaymentResponse, error) {
 	// Call service
-	order, err := h.service.ProcessPayment(ctx, req.OrderId, req.PaymentMethod)
+	o, err := h.service.ProcessPayment(ctx, req.OrderId, req.PaymentMethod, idempotencyKey(ctx, req.IdempotencyKey))
 	if err != nil {
 		log.Printf("ProcessPayment failed: %v", err)
 		return nil, err
@@ -56,8 +87,711 @@ func (h *OrderGRPCHandler) ProcessPayment(ctx context.Context, req *order.Paymen
 
 	// Convert response
 	return &order.PaymentResponse{
-		PaymentId:  order.PaymentID,
-		Status:     string(order.Status),
-		PaymentUrl: order.PaymentURL,
+		PaymentId:  o.PaymentID,
+		Status:     string(o.Status),
+		PaymentUrl: o.PaymentURL,
+	}, nil
+}
+
+func (h *OrderGRPCHandler) GetOrder(ctx context.Context, req *order.GetOrderRequest) (*order.Order, error) {
+	// Call service
+	o, err := h.service.GetOrder(ctx, req.OrderId)
+	if err != nil {
+		log.Printf("GetOrder failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toOrderProto(o), nil
+}
+
+func (h *OrderGRPCHandler) WatchOrder(req *order.WatchOrderRequest, stream order.OrderService_WatchOrderServer) error {
+	// Call service
+	err := h.service.WatchOrder(stream.Context(), req.OrderId, func(o *domain.Order, change domain.StatusChange) error {
+		// Convert response
+		return stream.Send(&order.OrderStatusUpdate{
+			OrderId: o.ID,
+			Status:  string(o.Status),
+			Change:  toStatusChangeProto(change),
+			Payment: &order.PaymentInfo{
+				PaymentId:  o.PaymentID,
+				PaymentUrl: o.PaymentURL,
+			},
+			Total: toMoneyProto(o.Total),
+		})
+	})
+	if err != nil {
+		log.Printf("WatchOrder failed: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *OrderGRPCHandler) ListOrders(ctx context.Context, req *order.ListOrdersRequest) (*order.ListOrdersResponse, error) {
+	// Convert request to domain objects
+	userID, err := callerID(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []domain.OrderStatus
+	for _, s := range req.Statuses {
+		statuses = append(statuses, domain.OrderStatus(s))
+	}
+
+	// Call service
+	orders, nextPageToken, err := h.service.ListOrders(ctx, userID, statuses, int(req.PageSize), req.PageToken)
+	if err != nil {
+		log.Printf("ListOrders failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	resp := &order.ListOrdersResponse{
+		NextPageToken: nextPageToken,
+	}
+	for i := range orders {
+		resp.Orders = append(resp.Orders, toOrderProto(&orders[i]))
+	}
+
+	return resp, nil
+}
+
+func (h *OrderGRPCHandler) CancelOrder(ctx context.Context, req *order.CancelOrderRequest) (*order.Order, error) {
+	// Convert request to domain objects
+	actor, err := callerID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	o, err := h.service.CancelOrder(ctx, req.OrderId, actor, req.Reason)
+	if err != nil {
+		log.Printf("CancelOrder failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toOrderProto(o), nil
+}
+
+func (h *OrderGRPCHandler) RefundOrder(ctx context.Context, req *order.RefundOrderRequest) (*order.Order, error) {
+	// Convert request to domain objects
+	actor, err := callerID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var items []domain.RefundItem
+	for _, item := range req.Items {
+		items = append(items, domain.RefundItem{
+			ProductID: item.ProductId,
+			Quantity:  int(item.Quantity),
+		})
+	}
+
+	// Call service
+	o, err := h.service.RefundOrder(ctx, req.OrderId, actor, req.Reason, items)
+	if err != nil {
+		log.Printf("RefundOrder failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toOrderProto(o), nil
+}
+
+func (h *OrderGRPCHandler) HandlePaymentNotification(ctx context.Context, req *order.PaymentNotification) (*order.PaymentNotificationResponse, error) {
+	// Convert request to domain objects
+	notification := domain.PaymentNotification{
+		PaymentID:  req.PaymentId,
+		OrderID:    req.OrderId,
+		Status:     req.Status,
+		Amount:     fromMoneyProto(req.Amount),
+		OccurredAt: req.OccurredAt.AsTime(),
+		Signature:  req.Signature,
+	}
+
+	// Call service
+	o, err := h.service.HandlePaymentNotification(ctx, notification)
+	if err != nil {
+		log.Printf("HandlePaymentNotification failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return &order.PaymentNotificationResponse{
+		OrderId: o.ID,
+		Status:  string(o.Status),
 	}, nil
 }
+
+func (h *OrderGRPCHandler) CreatePromotion(ctx context.Context, req *order.CreatePromotionRequest) (*order.Promotion, error) {
+	// Convert request to domain objects
+	pb := req.Promotion
+	if pb == nil {
+		pb = &order.Promotion{}
+	}
+	promotion := &domain.Promotion{
+		Code:         pb.Code,
+		Name:         pb.Name,
+		Type:         domain.PromotionType(pb.Type),
+		PercentOff:   pb.PercentOff,
+		AmountOff:    fromMoneyProto(pb.AmountOff),
+		BuyQuantity:  int(pb.BuyQuantity),
+		GetQuantity:  int(pb.GetQuantity),
+		ProductIDs:   pb.ProductIds,
+		MinSpend:     fromMoneyProto(pb.MinSpend),
+		PerUserLimit: int(pb.PerUserLimit),
+		TotalLimit:   int(pb.TotalLimit),
+	}
+	if pb.StartsAt != nil {
+		promotion.StartsAt = pb.StartsAt.AsTime()
+	}
+	if pb.EndsAt != nil {
+		promotion.EndsAt = pb.EndsAt.AsTime()
+	}
+
+	// Call service
+	p, err := h.service.CreatePromotion(ctx, promotion)
+	if err != nil {
+		log.Printf("CreatePromotion failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	resp := &order.Promotion{
+		Id:           p.ID,
+		Code:         p.Code,
+		Name:         p.Name,
+		Type:         string(p.Type),
+		PercentOff:   p.PercentOff,
+		AmountOff:    toMoneyProto(p.AmountOff),
+		BuyQuantity:  int32(p.BuyQuantity),
+		GetQuantity:  int32(p.GetQuantity),
+		ProductIds:   p.ProductIDs,
+		MinSpend:     toMoneyProto(p.MinSpend),
+		PerUserLimit: int32(p.PerUserLimit),
+		TotalLimit:   int32(p.TotalLimit),
+		Uses:         int32(p.Uses),
+		StartsAt:     timestamppb.New(p.StartsAt),
+		Active:       p.Active,
+	}
+	if !p.EndsAt.IsZero() {
+		resp.EndsAt = timestamppb.New(p.EndsAt)
+	}
+
+	return resp, nil
+}
+
+func (h *OrderGRPCHandler) GetCart(ctx context.Context, req *order.GetCartRequest) (*order.Cart, error) {
+	// Convert request to domain objects
+	userID, guestID, err := cartOwner(ctx, req.UserId, req.GuestId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	c, err := h.service.GetCart(ctx, userID, guestID)
+	if err != nil {
+		log.Printf("GetCart failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toCartProto(c), nil
+}
+
+func (h *OrderGRPCHandler) AddCartItem(ctx context.Context, req *order.CartItemRequest) (*order.Cart, error) {
+	// Convert request to domain objects
+	userID, guestID, err := cartOwner(ctx, req.UserId, req.GuestId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	c, err := h.service.AddCartItem(ctx, userID, guestID, req.ProductId, int(req.Quantity))
+	if err != nil {
+		log.Printf("AddCartItem failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toCartProto(c), nil
+}
+
+func (h *OrderGRPCHandler) UpdateCartItem(ctx context.Context, req *order.CartItemRequest) (*order.Cart, error) {
+	// Convert request to domain objects
+	userID, guestID, err := cartOwner(ctx, req.UserId, req.GuestId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	c, err := h.service.UpdateCartItem(ctx, userID, guestID, req.ProductId, int(req.Quantity))
+	if err != nil {
+		log.Printf("UpdateCartItem failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toCartProto(c), nil
+}
+
+func (h *OrderGRPCHandler) RemoveCartItem(ctx context.Context, req *order.CartItemRequest) (*order.Cart, error) {
+	// Convert request to domain objects
+	userID, guestID, err := cartOwner(ctx, req.UserId, req.GuestId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	c, err := h.service.RemoveCartItem(ctx, userID, guestID, req.ProductId)
+	if err != nil {
+		log.Printf("RemoveCartItem failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toCartProto(c), nil
+}
+
+func (h *OrderGRPCHandler) MergeCart(ctx context.Context, req *order.MergeCartRequest) (*order.Cart, error) {
+	// Convert request to domain objects
+	userID, err := callerID(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	c, err := h.service.MergeCart(ctx, userID, req.GuestId)
+	if err != nil {
+		log.Printf("MergeCart failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toCartProto(c), nil
+}
+
+func (h *OrderGRPCHandler) Checkout(ctx context.Context, req *order.CheckoutRequest) (*order.Order, error) {
+	// Convert request to domain objects
+	userID, err := callerID(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	delivery := toDelivery(req.ShippingAddress, req.BillingAddress, req.ShippingMethod, req.Destination)
+
+	// Call service
+	o, err := h.service.Checkout(ctx, userID, delivery, req.CouponCode, idempotencyKey(ctx, req.IdempotencyKey))
+	if err != nil {
+		log.Printf("Checkout failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toOrderProto(o), nil
+}
+
+func (h *OrderGRPCHandler) UpdateSubOrderStatus(ctx context.Context, req *order.UpdateSubOrderStatusRequest) (*order.Order, error) {
+	// Convert request to domain objects
+	actor, err := callerID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	o, err := h.service.UpdateSubOrderStatus(ctx, req.OrderId, req.SubOrderId, domain.OrderStatus(req.Status), actor, req.Reason)
+	if err != nil {
+		log.Printf("UpdateSubOrderStatus failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toOrderProto(o), nil
+}
+
+func toCartProto(c *domain.Cart) *order.Cart {
+	pb := &order.Cart{
+		UserId:    c.UserID,
+		GuestId:   c.GuestID,
+		UpdatedAt: timestamppb.New(c.UpdatedAt),
+	}
+	if c.Subtotal.Currency != "" {
+		pb.Subtotal = toMoneyProto(c.Subtotal)
+	}
+
+	for _, item := range c.Items {
+		pb.Items = append(pb.Items, &order.CartItem{
+			ProductId: item.ProductID,
+			Name:      item.Name,
+			Quantity:  int32(item.Quantity),
+			Price:     toMoneyProto(item.Price),
+			Stock:     int32(item.Stock),
+			Available: item.Available,
+		})
+	}
+
+	return pb
+}
+
+func (h *OrderGRPCHandler) CreateSubscription(ctx context.Context, req *order.CreateSubscriptionRequest) (*order.Subscription, error) {
+	// Convert request to domain objects
+	userID, err := callerID(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var currency money.Currency
+	if req.Currency != "" {
+		currency, err = money.ParseCurrency(req.Currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var items []domain.SubscriptionItem
+	for _, item := range req.Items {
+		items = append(items, domain.SubscriptionItem{
+			ProductID: item.ProductId,
+			Quantity:  int(item.Quantity),
+		})
+	}
+
+	var schedule domain.Schedule
+	if req.Schedule != nil {
+		schedule = domain.Schedule{
+			Unit:  domain.ScheduleUnit(req.Schedule.Unit),
+			Every: int(req.Schedule.Every),
+		}
+	}
+
+	var firstRunAt time.Time
+	if req.FirstRunAt != nil {
+		firstRunAt = req.FirstRunAt.AsTime()
+	}
+
+	delivery := toDelivery(req.ShippingAddress, req.BillingAddress, req.ShippingMethod, nil)
+
+	// Call service
+	sub, err := h.service.CreateSubscription(ctx, userID, items, schedule, currency, delivery, req.PaymentMethod, firstRunAt)
+	if err != nil {
+		log.Printf("CreateSubscription failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toSubscriptionProto(sub), nil
+}
+
+func (h *OrderGRPCHandler) GetSubscription(ctx context.Context, req *order.SubscriptionRequest) (*order.Subscription, error) {
+	// Call service
+	sub, err := h.service.GetSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		log.Printf("GetSubscription failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toSubscriptionProto(sub), nil
+}
+
+func (h *OrderGRPCHandler) ListSubscriptions(ctx context.Context, req *order.ListSubscriptionsRequest) (*order.ListSubscriptionsResponse, error) {
+	// Convert request to domain objects
+	userID, err := callerID(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call service
+	subs, err := h.service.ListSubscriptions(ctx, userID)
+	if err != nil {
+		log.Printf("ListSubscriptions failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	resp := &order.ListSubscriptionsResponse{}
+	for i := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, toSubscriptionProto(&subs[i]))
+	}
+	return resp, nil
+}
+
+func (h *OrderGRPCHandler) PauseSubscription(ctx context.Context, req *order.SubscriptionRequest) (*order.Subscription, error) {
+	// Call service
+	sub, err := h.service.PauseSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		log.Printf("PauseSubscription failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toSubscriptionProto(sub), nil
+}
+
+func (h *OrderGRPCHandler) ResumeSubscription(ctx context.Context, req *order.ResumeSubscriptionRequest) (*order.Subscription, error) {
+	// Call service
+	sub, err := h.service.ResumeSubscription(ctx, req.SubscriptionId, req.PaymentMethod)
+	if err != nil {
+		log.Printf("ResumeSubscription failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toSubscriptionProto(sub), nil
+}
+
+func (h *OrderGRPCHandler) SkipSubscription(ctx context.Context, req *order.SubscriptionRequest) (*order.Subscription, error) {
+	// Call service
+	sub, err := h.service.SkipSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		log.Printf("SkipSubscription failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toSubscriptionProto(sub), nil
+}
+
+func (h *OrderGRPCHandler) CancelSubscription(ctx context.Context, req *order.SubscriptionRequest) (*order.Subscription, error) {
+	// Call service
+	sub, err := h.service.CancelSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		log.Printf("CancelSubscription failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return toSubscriptionProto(sub), nil
+}
+
+func toDelivery(shipping, billing *order.Address, method string, destination *order.Destination) domain.Delivery {
+	delivery := domain.Delivery{
+		ShippingAddress: fromAddressProto(shipping),
+		BillingAddress:  fromAddressProto(billing),
+		ShippingMethod:  method,
+	}
+	if destination != nil {
+		delivery.Destination = &domain.Destination{
+			Country: destination.Country,
+			Region:  destination.Region,
+		}
+	}
+	return delivery
+}
+
+func toOrderProto(o *domain.Order) *order.Order {
+	pb := &order.Order{
+		Id:     o.ID,
+		UserId: o.UserID,
+		Total:  toMoneyProto(o.Total),
+		Status: string(o.Status),
+		Payment: &order.PaymentInfo{
+			PaymentId:  o.PaymentID,
+			PaymentUrl: o.PaymentURL,
+		},
+		CreatedAt:     timestamppb.New(o.CreatedAt),
+		UpdatedAt:     timestamppb.New(o.UpdatedAt),
+		PriceMismatch: o.PriceMismatch,
+		RefundedTotal: toMoneyProto(o.RefundedTotal),
+		Subtotal:      toMoneyProto(o.Subtotal),
+		DiscountTotal: toMoneyProto(o.DiscountTotal),
+		TaxMode:       string(o.TaxMode),
+		TaxTotal:      toMoneyProto(o.TaxTotal),
+		Items:         toOrderItemsProto(o.Items),
+
+		ShippingAddress: toAddressProto(o.ShippingAddress),
+		BillingAddress:  toAddressProto(o.BillingAddress),
+		ShippingMethod:  o.ShippingMethod,
+		ShippingCost:    toMoneyProto(o.ShippingCost),
+		SubOrders:       toSubOrdersProto(o.SubOrders),
+	}
+
+	if o.Destination != nil {
+		pb.Destination = &order.Destination{
+			Country: o.Destination.Country,
+			Region:  o.Destination.Region,
+		}
+	}
+
+	for _, discount := range o.Discounts {
+		pb.Discounts = append(pb.Discounts, &order.AppliedDiscount{
+			PromotionId: discount.PromotionID,
+			Code:        discount.Code,
+			Name:        discount.Name,
+			Amount:      toMoneyProto(discount.Amount),
+		})
+	}
+
+	for _, refund := range o.Refunds {
+		r := &order.Refund{
+			RefundId:  refund.ID,
+			Amount:    toMoneyProto(refund.Amount),
+			Actor:     refund.Actor,
+			Reason:    refund.Reason,
+			CreatedAt: timestamppb.New(refund.CreatedAt),
+			Pending:   refund.IsPending(),
+		}
+		for _, item := range refund.Items {
+			r.Items = append(r.Items, &order.RefundItem{
+				ProductId: item.ProductID,
+				Quantity:  int32(item.Quantity),
+			})
+		}
+		pb.Refunds = append(pb.Refunds, r)
+	}
+
+	for _, change := range o.StatusHistory {
+		pb.StatusHistory = append(pb.StatusHistory, toStatusChangeProto(change))
+	}
+
+	return pb
+}
+
+func toOrderItemsProto(items []domain.OrderItem) []*order.OrderItem {
+	var pb []*order.OrderItem
+	for _, item := range items {
+		pb = append(pb, &order.OrderItem{
+			ProductId:   item.ProductID,
+			Quantity:    int32(item.Quantity),
+			Price:       toMoneyProto(item.Price),
+			Name:        item.Name,
+			TaxCategory: item.TaxCategory,
+			TaxRate:     item.TaxRate,
+			Tax:         toMoneyProto(item.Tax),
+			SellerId:    item.SellerID,
+			Discount:    toMoneyProto(item.Discount),
+
+			RefundedQuantity: int32(item.RefundedQuantity),
+		})
+	}
+	return pb
+}
+
+func toSubOrdersProto(subOrders []domain.SubOrder) []*order.SubOrder {
+	var pb []*order.SubOrder
+	for _, sub := range subOrders {
+		s := &order.SubOrder{
+			Id:            sub.ID,
+			SellerId:      sub.SellerID,
+			Status:        string(sub.Status),
+			Subtotal:      toMoneyProto(sub.Subtotal),
+			DiscountTotal: toMoneyProto(sub.DiscountTotal),
+			TaxTotal:      toMoneyProto(sub.TaxTotal),
+			ShippingCost:  toMoneyProto(sub.ShippingCost),
+			Total:         toMoneyProto(sub.Total),
+		}
+		for _, change := range sub.StatusHistory {
+			s.StatusHistory = append(s.StatusHistory, toStatusChangeProto(change))
+		}
+		pb = append(pb, s)
+	}
+	return pb
+}
+
+func toSubscriptionProto(sub *domain.Subscription) *order.Subscription {
+	pb := &order.Subscription{
+		Id:       sub.ID,
+		UserId:   sub.UserID,
+		Currency: string(sub.Currency),
+		Schedule: &order.Schedule{
+			Unit:  string(sub.Schedule.Unit),
+			Every: int32(sub.Schedule.Every),
+		},
+		NextRunAt:       timestamppb.New(sub.NextRunAt),
+		ShippingAddress: toAddressProto(sub.ShippingAddress),
+		BillingAddress:  toAddressProto(sub.BillingAddress),
+		ShippingMethod:  sub.ShippingMethod,
+		PaymentMethod:   sub.PaymentMethod,
+		Status:          string(sub.Status),
+		PauseReason:     sub.PauseReason,
+		PendingOrderId:  sub.PendingOrderID,
+		PaymentAttempts: int32(sub.PaymentAttempts),
+		LastError:       sub.LastError,
+		LastOrderId:     sub.LastOrderID,
+		CreatedAt:       timestamppb.New(sub.CreatedAt),
+		UpdatedAt:       timestamppb.New(sub.UpdatedAt),
+	}
+	if sub.RetryAt != nil {
+		pb.RetryAt = timestamppb.New(*sub.RetryAt)
+	}
+	for _, item := range sub.Items {
+		pb.Items = append(pb.Items, &order.SubscriptionItem{
+			ProductId: item.ProductID,
+			Quantity:  int32(item.Quantity),
+		})
+	}
+	return pb
+}
+
+func toStatusChangeProto(change domain.StatusChange) *order.StatusChange {
+	return &order.StatusChange{
+		From:   string(change.From),
+		To:     string(change.To),
+		Actor:  change.Actor,
+		Reason: change.Reason,
+		At:     timestamppb.New(change.At),
+	}
+}
+
+func toAddressProto(a *domain.Address) *order.Address {
+	if a == nil {
+		return nil
+	}
+	return &order.Address{
+		Name:       a.Name,
+		Phone:      a.Phone,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func fromAddressProto(a *order.Address) *domain.Address {
+	if a == nil {
+		return nil
+	}
+	return &domain.Address{
+		Name:       a.Name,
+		Phone:      a.Phone,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func toMoneyProto(m money.Money) *order.Money {
+	return &order.Money{
+		Amount:   m.Amount,
+		Currency: string(m.Currency),
+	}
+}
+
+func fromMoneyProto(m *order.Money) money.Money {
+	if m == nil {
+		return money.Money{}
+	}
+	return money.New(m.Amount, money.Currency(m.Currency))
+}
+
+// idempotencyKey returns the key from the request message, falling back to
+// the idempotency-key metadata header.
+func idempotencyKey(ctx context.Context, key string) string {
+	if key != "" {
+		return key
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(idempotencyKeyHeader); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
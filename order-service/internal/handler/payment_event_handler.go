@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"order-service/internal/domain"
+	"order-service/internal/service"
+)
+
+// PaymentStatusTopic carries the signed payment notifications published by the
+// payment service.
+const PaymentStatusTopic = "payment.status_changed"
+
+type PaymentEventHandler struct {
+	service *service.OrderService
+}
+
+func NewPaymentEventHandler(svc *service.OrderService) *PaymentEventHandler {
+	return &PaymentEventHandler{
+		service: svc,
+	}
+}
+
+// Handle applies a payment status event. Events that can never be applied
+// are logged and dropped, other failures are returned to have the event
+// delivered again.
+func (h *PaymentEventHandler) Handle(ctx context.Context, payload []byte) error {
+	var notification domain.PaymentNotification
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		log.Printf("dropping malformed payment event: %v", err)
+		return nil
+	}
+
+	_, err := h.service.HandlePaymentNotification(ctx, notification)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, service.ErrInvalidSignature),
+		errors.Is(err, service.ErrUnknownPayment),
+		errors.Is(err, service.ErrPaymentAmountMismatch),
+		errors.Is(err, service.ErrOrderNotFound):
+		log.Printf("dropping payment event for order %s: %v", notification.OrderID, err)
+		return nil
+	default:
+		return err
+	}
+}
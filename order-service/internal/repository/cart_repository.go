@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"order-service/internal/domain"
+)
+
+type CartRepository interface {
+	FindByID(ctx context.Context, id string) (*domain.Cart, error)
+	// Save creates the cart, or replaces it if it is still at the version it
+	// was read at, and bumps the version. It returns an error matching
+	// ErrConflict otherwise.
+	Save(ctx context.Context, cart *domain.Cart) error
+	// Delete deletes the cart if it is still at the version it was read at.
+	// It returns an error matching ErrConflict otherwise.
+	Delete(ctx context.Context, cart *domain.Cart) error
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"order-service/internal/domain"
+)
+
+type IdempotencyRepository interface {
+	// Begin stores a new in-progress record. When a record with the same ID
+	// exists it is returned instead and nothing is stored.
+	Begin(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error)
+	// Reclaim takes over an in-progress record whose lock expired before now.
+	Reclaim(ctx context.Context, id string, now, lockedUntil time.Time) (bool, error)
+	Complete(ctx context.Context, id string, response []byte) error
+	Delete(ctx context.Context, id string) error
+}
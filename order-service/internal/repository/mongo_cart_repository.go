@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"order-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoCartRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoCartRepository(db *mongo.Database, timeout time.Duration) *MongoCartRepository {
+	return &MongoCartRepository{
+		collection: db.Collection("carts"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the TTL index that drops abandoned guest carts.
+func (r *MongoCartRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *MongoCartRepository) FindByID(ctx context.Context, id string) (*domain.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var cart domain.Cart
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&cart)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func (r *MongoCartRepository) Save(ctx context.Context, cart *domain.Cart) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	updated := *cart
+	updated.UpdatedAt = time.Now()
+	updated.Version++
+
+	// A new cart is inserted, another request inserting it first is a
+	// conflict on the duplicate ID
+	opts := options.Replace().SetUpsert(cart.Version == 0)
+	result, err := r.collection.ReplaceOne(ctx, cartVersionFilter(cart), &updated, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("cart %s at version %d: %w", cart.ID, cart.Version, ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 && result.UpsertedCount != 1 {
+		return fmt.Errorf("cart %s at version %d: %w", cart.ID, cart.Version, ErrConflict)
+	}
+
+	*cart = updated
+	return nil
+}
+
+func (r *MongoCartRepository) Delete(ctx context.Context, cart *domain.Cart) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.collection.DeleteOne(ctx, cartVersionFilter(cart))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("cart %s at version %d: %w", cart.ID, cart.Version, ErrConflict)
+	}
+	return nil
+}
+
+// cartVersionFilter matches the cart at the version it was read at.
+func cartVersionFilter(cart *domain.Cart) bson.M {
+	return bson.M{"_id": cart.ID, "version": cart.Version}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"order-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoIdempotencyRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoIdempotencyRepository(db *mongo.Database, timeout time.Duration) *MongoIdempotencyRepository {
+	return &MongoIdempotencyRepository{
+		collection: db.Collection("idempotency_keys"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the TTL index that drops records past their retention.
+func (r *MongoIdempotencyRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *MongoIdempotencyRepository) Begin(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, record)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	var existing domain.IdempotencyRecord
+	if err := r.collection.FindOne(ctx, bson.M{"_id": record.ID}).Decode(&existing); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *MongoIdempotencyRepository) Reclaim(ctx context.Context, id string, now, lockedUntil time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":          id,
+		"status":       domain.IdempotencyStatusInProgress,
+		"locked_until": bson.M{"$lt": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": lockedUntil}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *MongoIdempotencyRepository) Complete(ctx context.Context, id string, response []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":   domain.IdempotencyStatusCompleted,
+			"response": response,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *MongoIdempotencyRepository) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"order-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// unpaidOrderStatuses are the statuses of orders that can still be paid.
+var unpaidOrderStatuses = []domain.OrderStatus{
+	domain.OrderStatusPending,
+	domain.OrderStatusPaymentPending,
+	domain.OrderStatusFailed,
+}
+
+type MongoOrderRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoOrderRepository(db *mongo.Database, timeout time.Duration) *MongoOrderRepository {
+	return &MongoOrderRepository{
+		collection: db.Collection("orders"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes backing the user, status and date range queries.
+func (r *MongoOrderRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+func (r *MongoOrderRepository) Create(ctx context.Context, order *domain.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	order.Version = 1
+	_, err := r.collection.InsertOne(ctx, order)
+	return err
+}
+
+func (r *MongoOrderRepository) FindByID(ctx context.Context, id string) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var order domain.Order
+	filter := bson.M{"_id": id}
+	err := r.collection.FindOne(ctx, filter).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *MongoOrderRepository) Update(ctx context.Context, order *domain.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	updatedAt := time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"items":          order.Items,
+			"total":          order.Total,
+			"status":         order.Status,
+			"status_history": order.StatusHistory,
+			"payment_id":     order.PaymentID,
+			"payment_url":    order.PaymentURL,
+			"reservation_id": order.ReservationID,
+			"refunds":        order.Refunds,
+			"refunded_total": order.RefundedTotal,
+			"sub_orders":     order.SubOrders,
+			"updated_at":     updatedAt,
+			"version":        order.Version + 1,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, versionFilter(order), update, options.Update().SetUpsert(false))
+	if err != nil {
+		return err
+	}
+	// A deleted order is reported as a conflict too
+	if result.MatchedCount != 1 {
+		return &ConflictError{OrderID: order.ID, Version: order.Version}
+	}
+
+	order.UpdatedAt = updatedAt
+	order.Version++
+	return nil
+}
+
+// versionFilter matches the order at the version it was read at.
+func versionFilter(order *domain.Order) bson.M {
+	return bson.M{"_id": order.ID, "version": order.Version}
+}
+
+func (r *MongoOrderRepository) FindUnpaidBefore(ctx context.Context, before time.Time, limit int64) ([]domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"status":     bson.M{"$in": unpaidOrderStatuses},
+		"created_at": bson.M{"$lt": before},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []domain.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r *MongoOrderRepository) Claim(ctx context.Context, order *domain.Order) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"updated_at": now,
+		"version":    order.Version + 1,
+	}}
+
+	result, err := r.collection.UpdateOne(ctx, versionFilter(order), update)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount != 1 {
+		return false, nil
+	}
+
+	order.UpdatedAt = now
+	order.Version++
+	return true, nil
+}
+
+func (r *MongoOrderRepository) FindByUser(ctx context.Context, userID string, limit, offset int64) ([]domain.Order, error) {
+	return r.find(ctx, bson.M{"user_id": userID}, limit, offset)
+}
+
+func (r *MongoOrderRepository) FindByStatus(ctx context.Context, status domain.OrderStatus, limit, offset int64) ([]domain.Order, error) {
+	return r.find(ctx, bson.M{"status": status}, limit, offset)
+}
+
+func (r *MongoOrderRepository) FindByDateRange(ctx context.Context, from, to time.Time, limit, offset int64) ([]domain.Order, error) {
+	filter := bson.M{
+		"created_at": bson.M{
+			"$gte": from,
+			"$lt":  to,
+		},
+	}
+	return r.find(ctx, filter, limit, offset)
+}
+
+func (r *MongoOrderRepository) List(ctx context.Context, filter domain.OrderFilter) ([]domain.Order, error) {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if filter.After != nil {
+		query["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": filter.After.CreatedAt}},
+			bson.M{
+				"created_at": filter.After.CreatedAt,
+				"_id":        bson.M{"$lt": filter.After.ID},
+			},
+		}
+	}
+	return r.find(ctx, query, filter.Limit, 0)
+}
+
+// find runs a query sorted by newest first. A zero limit returns all matches.
+func (r *MongoOrderRepository) find(ctx context.Context, filter bson.M, limit, offset int64) ([]domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []domain.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// Watch opens a change stream on the order, which needs MongoDB to run as a
+// replica set. The stream outlives the repository timeout.
+func (r *MongoOrderRepository) Watch(ctx context.Context, id string) (OrderChanges, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"documentKey._id": id,
+			"operationType":   bson.M{"$in": bson.A{"insert", "update", "replace"}},
+		}}},
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+	stream, err := r.collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoOrderChanges{stream: stream}, nil
+}
+
+type mongoOrderChanges struct {
+	stream *mongo.ChangeStream
+}
+
+func (c *mongoOrderChanges) Next(ctx context.Context) (*domain.Order, error) {
+	for c.stream.Next(ctx) {
+		var change struct {
+			FullDocument *domain.Order `bson:"fullDocument"`
+		}
+		if err := c.stream.Decode(&change); err != nil {
+			return nil, err
+		}
+		// The order may be gone by the time an update is looked up
+		if change.FullDocument != nil {
+			return change.FullDocument, nil
+		}
+	}
+	if err := c.stream.Err(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrWatchClosed
+}
+
+func (c *mongoOrderChanges) Close(ctx context.Context) error {
+	return c.stream.Close(ctx)
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"order-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoPromotionRepository struct {
+	promotions *mongo.Collection
+	usages     *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoPromotionRepository(db *mongo.Database, timeout time.Duration) *MongoPromotionRepository {
+	return &MongoPromotionRepository{
+		promotions: db.Collection("promotions"),
+		usages:     db.Collection("promotion_usages"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on coupon codes and the index used
+// to find automatic promotions.
+func (r *MongoPromotionRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.promotions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"code": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "active", Value: 1}, {Key: "starts_at", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoPromotionRepository) Create(ctx context.Context, promotion *domain.Promotion) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.promotions.InsertOne(ctx, promotion)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPromotionCodeTaken
+	}
+	return err
+}
+
+func (r *MongoPromotionRepository) FindByCode(ctx context.Context, code string) (*domain.Promotion, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var promotion domain.Promotion
+	err := r.promotions.FindOne(ctx, bson.M{"code": code}).Decode(&promotion)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func (r *MongoPromotionRepository) FindAutomatic(ctx context.Context, now time.Time) ([]domain.Promotion, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"code":      bson.M{"$exists": false},
+		"active":    true,
+		"starts_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"ends_at": time.Time{}},
+			bson.M{"ends_at": bson.M{"$gt": now}},
+		},
+	}
+	cursor, err := r.promotions.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var promotions []domain.Promotion
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+
+	return promotions, nil
+}
+
+func (r *MongoPromotionRepository) UserUses(ctx context.Context, promotionID, userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var usage struct {
+		Uses int `bson:"uses"`
+	}
+	err := r.usages.FindOne(ctx, bson.M{"_id": promotionID + ":" + userID}).Decode(&usage)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return usage.Uses, nil
+}
+
+func (r *MongoPromotionRepository) Redeem(ctx context.Context, promotion *domain.Promotion, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// Count the use against the total limit
+	filter := bson.M{"_id": promotion.ID}
+	if promotion.TotalLimit > 0 {
+		filter["uses"] = bson.M{"$lt": promotion.TotalLimit}
+	}
+	result, err := r.promotions.UpdateOne(ctx, filter, bson.M{
+		"$inc": bson.M{"uses": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 {
+		return ErrPromotionLimitReached
+	}
+
+	// Count the use against the user's limit. Once the user's counter is at
+	// the limit the filter no longer matches and the upsert collides with
+	// the existing counter.
+	usageFilter := bson.M{"_id": promotion.ID + ":" + userID}
+	if promotion.PerUserLimit > 0 {
+		usageFilter["uses"] = bson.M{"$lt": promotion.PerUserLimit}
+	}
+	_, err = r.usages.UpdateOne(ctx, usageFilter, bson.M{
+		"$inc": bson.M{"uses": 1},
+		"$set": bson.M{
+			"promotion_id": promotion.ID,
+			"user_id":      userID,
+			"updated_at":   time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPromotionLimitReached
+	}
+	return err
+}
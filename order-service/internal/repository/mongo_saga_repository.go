@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"order-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrSagaInProgress = errors.New("a checkout is already in progress for this order")
+
+var unfinishedSagaStatuses = []domain.SagaStatus{
+	domain.SagaStatusRunning,
+	domain.SagaStatusCompensating,
+}
+
+type MongoSagaRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoSagaRepository(db *mongo.Database, timeout time.Duration) *MongoSagaRepository {
+	return &MongoSagaRepository{
+		collection: db.Collection("checkout_sagas"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes used by the order lookup and the recovery sweep.
+func (r *MongoSagaRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// At most one unfinished checkout per order
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"active": true}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoSagaRepository) Create(ctx context.Context, saga *domain.CheckoutSaga) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	saga.Active = !saga.Status.IsFinished()
+
+	_, err := r.collection.InsertOne(ctx, saga)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrSagaInProgress
+	}
+	return err
+}
+
+func (r *MongoSagaRepository) FindByID(ctx context.Context, id string) (*domain.CheckoutSaga, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoSagaRepository) FindActiveByOrderID(ctx context.Context, orderID string) (*domain.CheckoutSaga, error) {
+	return r.findOne(ctx, bson.M{
+		"order_id": orderID,
+		"active":   true,
+	})
+}
+
+func (r *MongoSagaRepository) Update(ctx context.Context, saga *domain.CheckoutSaga) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	saga.UpdatedAt = time.Now()
+	saga.Active = !saga.Status.IsFinished()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": saga.ID}, saga)
+	return err
+}
+
+func (r *MongoSagaRepository) FindStale(ctx context.Context, before, awaitingBefore time.Time, limit int64) ([]domain.CheckoutSaga, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{
+			"status":     bson.M{"$in": unfinishedSagaStatuses},
+			"updated_at": bson.M{"$lt": before},
+		},
+		bson.M{
+			"status":     domain.SagaStatusAwaitingPayment,
+			"updated_at": bson.M{"$lt": awaitingBefore},
+		},
+	}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sagas []domain.CheckoutSaga
+	if err := cursor.All(ctx, &sagas); err != nil {
+		return nil, err
+	}
+
+	return sagas, nil
+}
+
+func (r *MongoSagaRepository) Claim(ctx context.Context, saga *domain.CheckoutSaga) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":        saga.ID,
+		"updated_at": saga.UpdatedAt,
+	}
+	update := bson.M{"$set": bson.M{"updated_at": now}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount != 1 {
+		return false, nil
+	}
+
+	saga.UpdatedAt = now
+	return true, nil
+}
+
+func (r *MongoSagaRepository) findOne(ctx context.Context, filter bson.M) (*domain.CheckoutSaga, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var saga domain.CheckoutSaga
+	err := r.collection.FindOne(ctx, filter).Decode(&saga)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &saga, nil
+}
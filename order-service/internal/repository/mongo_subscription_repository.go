@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"order-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoSubscriptionRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoSubscriptionRepository(db *mongo.Database, timeout time.Duration) *MongoSubscriptionRepository {
+	return &MongoSubscriptionRepository{
+		collection: db.Collection("subscriptions"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes used to list a user's subscriptions and
+// to find the due ones.
+func (r *MongoSubscriptionRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "retry_at", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoSubscriptionRepository) Create(ctx context.Context, subscription *domain.Subscription) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	subscription.Version = 1
+	_, err := r.collection.InsertOne(ctx, subscription)
+	return err
+}
+
+func (r *MongoSubscriptionRepository) FindByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var subscription domain.Subscription
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (r *MongoSubscriptionRepository) FindByUser(ctx context.Context, userID string) ([]domain.Subscription, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	return r.find(ctx, bson.M{"user_id": userID}, opts)
+}
+
+func (r *MongoSubscriptionRepository) Update(ctx context.Context, subscription *domain.Subscription) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	updated := *subscription
+	updated.UpdatedAt = time.Now()
+	updated.Version++
+
+	filter := bson.M{"_id": subscription.ID, "version": subscription.Version}
+	result, err := r.collection.ReplaceOne(ctx, filter, &updated)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 {
+		return fmt.Errorf("subscription %s at version %d: %w", subscription.ID, subscription.Version, ErrConflict)
+	}
+
+	*subscription = updated
+	return nil
+}
+
+func (r *MongoSubscriptionRepository) FindDue(ctx context.Context, now time.Time, limit int64) ([]domain.Subscription, error) {
+	filter := bson.M{
+		"status": domain.SubscriptionStatusActive,
+		"$or": bson.A{
+			bson.M{"retry_at": bson.M{"$lte": now}},
+			bson.M{"retry_at": nil, "next_run_at": bson.M{"$lte": now}},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "next_run_at", Value: 1}}).
+		SetLimit(limit)
+	return r.find(ctx, filter, opts)
+}
+
+func (r *MongoSubscriptionRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]domain.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []domain.Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"order-service/internal/domain"
+)
+
+var (
+	// ErrConflict matches the errors of saves that lost a race with another
+	// save of the same order or subscription.
+	ErrConflict = errors.New("modified concurrently")
+	// ErrWatchClosed is returned by OrderChanges when the database ends the
+	// watch.
+	ErrWatchClosed = errors.New("order watch closed")
+)
+
+// ConflictError is returned when an order is saved from a version that is no
+// longer the stored one.
+type ConflictError struct {
+	OrderID string
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("order %s was modified after version %d", e.OrderID, e.Version)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+type OrderRepository interface {
+	Create(ctx context.Context, order *domain.Order) error
+	FindByID(ctx context.Context, id string) (*domain.Order, error)
+	// Update saves the order if it is still at the version it was read at and
+	// bumps the version. It returns a *ConflictError otherwise.
+	Update(ctx context.Context, order *domain.Order) error
+	FindByUser(ctx context.Context, userID string, limit, offset int64) ([]domain.Order, error)
+	FindByStatus(ctx context.Context, status domain.OrderStatus, limit, offset int64) ([]domain.Order, error)
+	FindByDateRange(ctx context.Context, from, to time.Time, limit, offset int64) ([]domain.Order, error)
+	List(ctx context.Context, filter domain.OrderFilter) ([]domain.Order, error)
+	// FindUnpaidBefore returns the pending, payment_pending and failed orders
+	// created before the given time, oldest first.
+	FindUnpaidBefore(ctx context.Context, before time.Time, limit int64) ([]domain.Order, error)
+	// Claim takes over an order for a background job by bumping its version.
+	// It returns false when another process saved the order since it was
+	// read.
+	Claim(ctx context.Context, order *domain.Order) (bool, error)
+	// Watch follows the changes saved to an order from now on.
+	Watch(ctx context.Context, id string) (OrderChanges, error)
+}
+
+// OrderChanges yields every saved version of a watched order.
+type OrderChanges interface {
+	// Next blocks until the order is saved again and returns it.
+	Next(ctx context.Context) (*domain.Order, error)
+	Close(ctx context.Context) error
+}
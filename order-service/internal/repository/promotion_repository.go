@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"order-service/internal/domain"
+)
+
+var (
+	ErrPromotionCodeTaken    = errors.New("promotion code is already in use")
+	ErrPromotionLimitReached = errors.New("promotion usage limit reached")
+)
+
+type PromotionRepository interface {
+	Create(ctx context.Context, promotion *domain.Promotion) error
+	FindByCode(ctx context.Context, code string) (*domain.Promotion, error)
+	// FindAutomatic returns the live promotions without a code.
+	FindAutomatic(ctx context.Context, now time.Time) ([]domain.Promotion, error)
+	// UserUses returns how many orders of the user used the promotion.
+	UserUses(ctx context.Context, promotionID, userID string) (int, error)
+	// Redeem records one use of the promotion by the user. It fails with
+	// ErrPromotionLimitReached when the total or per-user limit is used up.
+	// Run it in the transaction that saves the order so that a failed order
+	// does not use up the promotion.
+	Redeem(ctx context.Context, promotion *domain.Promotion, userID string) error
+}
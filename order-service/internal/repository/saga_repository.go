@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"order-service/internal/domain"
+)
+
+type SagaRepository interface {
+	Create(ctx context.Context, saga *domain.CheckoutSaga) error
+	FindByID(ctx context.Context, id string) (*domain.CheckoutSaga, error)
+	FindActiveByOrderID(ctx context.Context, orderID string) (*domain.CheckoutSaga, error)
+	Update(ctx context.Context, saga *domain.CheckoutSaga) error
+	// FindStale returns unfinished sagas that have not been saved since
+	// before, and sagas awaiting their payment since awaitingBefore.
+	FindStale(ctx context.Context, before, awaitingBefore time.Time, limit int64) ([]domain.CheckoutSaga, error)
+	// Claim takes over a stale saga. It returns false when another process
+	// saved the saga since it was read.
+	Claim(ctx context.Context, saga *domain.CheckoutSaga) (bool, error)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"order-service/internal/domain"
+)
+
+type SubscriptionRepository interface {
+	Create(ctx context.Context, subscription *domain.Subscription) error
+	FindByID(ctx context.Context, id string) (*domain.Subscription, error)
+	FindByUser(ctx context.Context, userID string) ([]domain.Subscription, error)
+	// Update saves the subscription if it is still at the version it was read
+	// at and bumps the version. It returns an error matching ErrConflict
+	// otherwise.
+	Update(ctx context.Context, subscription *domain.Subscription) error
+	// FindDue returns active subscriptions whose next run or payment retry is
+	// due at now, most overdue first.
+	FindDue(ctx context.Context, now time.Time, limit int64) ([]domain.Subscription, error)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"order-service/internal/domain"
+	"shared/auth"
+	"shared/jwt"
+)
+
+var (
+	ErrNotOrderOwner     = errors.New("order belongs to another user")
+	ErrNotSubOrderSeller = errors.New("sub-order belongs to another seller")
+	ErrNotSubscriber     = errors.New("subscription belongs to another user")
+)
+
+// authorizeOrder lets users act on their own orders only. Admins may act on
+// any order, and so may the workers of this service, whose contexts are
+// marked internal. Calls with neither claims nor the mark are refused.
+func authorizeOrder(ctx context.Context, order *domain.Order) error {
+	claims, err := caller(ctx)
+	if err != nil || claims == nil {
+		return err
+	}
+	if auth.IsPrivileged(claims) || order.UserID == claims.UserID {
+		return nil
+	}
+	return ErrNotOrderOwner
+}
+
+// authorizeSubOrder lets sellers act on their own sub-orders only. Admins and
+// internal callers may act on any sub-order.
+func authorizeSubOrder(ctx context.Context, sub *domain.SubOrder) error {
+	claims, err := caller(ctx)
+	if err != nil || claims == nil {
+		return err
+	}
+	if auth.IsPrivileged(claims) {
+		return nil
+	}
+	if sub.SellerID != "" && sub.SellerID == claims.UserID && auth.HasRole(claims, auth.RoleSeller) {
+		return nil
+	}
+	return ErrNotSubOrderSeller
+}
+
+// authorizeSubscription lets users act on their own subscriptions only, like
+// authorizeOrder.
+func authorizeSubscription(ctx context.Context, subscription *domain.Subscription) error {
+	claims, err := caller(ctx)
+	if err != nil || claims == nil {
+		return err
+	}
+	if auth.IsPrivileged(claims) || subscription.UserID == claims.UserID {
+		return nil
+	}
+	return ErrNotSubscriber
+}
+
+// caller returns the claims of the caller, or nil claims for internal calls,
+// which may act on anything.
+func caller(ctx context.Context) (*jwt.Claims, error) {
+	if _, ok := auth.InternalActor(ctx); ok {
+		return nil, nil
+	}
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return claims, nil
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"order-service/internal/client"
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+// maxMergedCarts bounds the guest carts a cart remembers merging.
+const maxMergedCarts = 10
+
+var (
+	ErrInvalidCart = errors.New("invalid cart request")
+	ErrEmptyCart   = errors.New("cart is empty")
+)
+
+// cartID keys carts by their owner, either a user or a guest.
+func cartID(userID, guestID string) (string, error) {
+	switch {
+	case userID != "" && guestID == "":
+		return "user:" + userID, nil
+	case guestID != "" && userID == "":
+		return "guest:" + guestID, nil
+	}
+	return "", ErrInvalidCart
+}
+
+// GetCart returns the cart of a user or a guest with the current names,
+// prices and stock of its items. The cart is returned as stored when the
+// catalog cannot be reached.
+func (s *OrderService) GetCart(ctx context.Context, userID, guestID string) (*domain.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cart, err := s.loadCart(ctx, userID, guestID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.refreshCart(ctx, cart); err != nil {
+		log.Printf("failed to refresh cart %s: %v", cart.ID, err)
+	}
+	return cart, nil
+}
+
+// AddCartItem adds quantity units of a product to the cart.
+func (s *OrderService) AddCartItem(ctx context.Context, userID, guestID, productID string, quantity int) (*domain.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if productID == "" || quantity <= 0 {
+		return nil, ErrInvalidCart
+	}
+
+	return s.updateCart(ctx, userID, guestID, productID, func(cart *domain.Cart) {
+		if item := cart.Item(productID); item != nil {
+			item.Quantity += quantity
+		} else {
+			cart.Items = append(cart.Items, domain.CartItem{
+				ProductID: productID,
+				Quantity:  quantity,
+				AddedAt:   time.Now(),
+			})
+		}
+	})
+}
+
+// UpdateCartItem sets the quantity of a product in the cart. A zero quantity
+// removes it.
+func (s *OrderService) UpdateCartItem(ctx context.Context, userID, guestID, productID string, quantity int) (*domain.Cart, error) {
+	if quantity == 0 {
+		return s.RemoveCartItem(ctx, userID, guestID, productID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if productID == "" || quantity < 0 {
+		return nil, ErrInvalidCart
+	}
+
+	return s.updateCart(ctx, userID, guestID, productID, func(cart *domain.Cart) {
+		if item := cart.Item(productID); item != nil {
+			item.Quantity = quantity
+		} else {
+			cart.Items = append(cart.Items, domain.CartItem{
+				ProductID: productID,
+				Quantity:  quantity,
+				AddedAt:   time.Now(),
+			})
+		}
+	})
+}
+
+// RemoveCartItem removes a product from the cart.
+func (s *OrderService) RemoveCartItem(ctx context.Context, userID, guestID, productID string) (*domain.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if productID == "" {
+		return nil, ErrInvalidCart
+	}
+
+	return s.updateCart(ctx, userID, guestID, "", func(cart *domain.Cart) {
+		items := cart.Items[:0]
+		for _, item := range cart.Items {
+			if item.ProductID != productID {
+				items = append(items, item)
+			}
+		}
+		cart.Items = items
+	})
+}
+
+// MergeCart moves the items of a guest cart into the user's cart when the
+// guest logs in. Quantities of products in both carts are added up. A merge
+// retried before the guest cart was deleted adds nothing again.
+func (s *OrderService) MergeCart(ctx context.Context, userID, guestID string) (*domain.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if userID == "" || guestID == "" {
+		return nil, ErrInvalidCart
+	}
+	guestCart, err := s.loadCart(ctx, "", guestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(guestCart.Items) == 0 {
+		return s.GetCart(ctx, userID, "")
+	}
+
+	merge := mergeKey(guestCart)
+	cart, err := s.updateCart(ctx, userID, "", "", func(cart *domain.Cart) {
+		if slices.Contains(cart.MergedCarts, merge) {
+			return
+		}
+		for _, guestItem := range guestCart.Items {
+			if item := cart.Item(guestItem.ProductID); item != nil {
+				item.Quantity += guestItem.Quantity
+			} else {
+				cart.Items = append(cart.Items, guestItem)
+			}
+		}
+		cart.MergedCarts = append(cart.MergedCarts, merge)
+		if len(cart.MergedCarts) > maxMergedCarts {
+			cart.MergedCarts = cart.MergedCarts[len(cart.MergedCarts)-maxMergedCarts:]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The items are safe in the user's cart, a guest cart left behind expires.
+	// A guest cart changed meanwhile is kept, so nothing added to it is lost.
+	if err := s.cartRepo.Delete(ctx, guestCart); err != nil {
+		log.Printf("failed to delete merged guest cart %s: %v", guestCart.ID, err)
+	}
+	return cart, nil
+}
+
+// mergeKey names a guest cart as it was merged. A guest cart created again
+// under the same ID, or changed since, has another key.
+func mergeKey(guestCart *domain.Cart) string {
+	return fmt.Sprintf("%s:%d:%d", guestCart.ID, guestCart.CreatedAt.UnixMilli(), guestCart.Version)
+}
+
+// Checkout creates an order from the user's cart and takes the ordered items
+// out of the cart. Items added while the order was placed stay. Guests merge
+// their cart into the user's cart first. Retries with the same idempotency
+// key return the order created by the first request.
+func (s *OrderService) Checkout(ctx context.Context, userID string, delivery domain.Delivery, couponCode, idempotencyKey string) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	id, err := cartID(userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	request := struct {
+		Delivery   domain.Delivery
+		CouponCode string
+	}{delivery, couponCode}
+
+	return s.idempotent(ctx, userID, operationCheckout, idempotencyKey, request, func() (*domain.Order, error) {
+		cart, err := s.cartRepo.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if cart == nil || len(cart.Items) == 0 {
+			return nil, ErrEmptyCart
+		}
+
+		// Orders are priced from the catalog, like CreateOrder
+		items := make([]domain.OrderItem, 0, len(cart.Items))
+		for _, item := range cart.Items {
+			items = append(items, domain.OrderItem{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+			})
+		}
+
+		order, err := s.createOrder(ctx, userID, "", items, delivery, couponCode)
+		if err != nil {
+			return nil, err
+		}
+
+		// The order is placed, a cart left behind only needs clearing by hand
+		if err := s.removeOrderedItems(ctx, cart); err != nil {
+			log.Printf("failed to clear cart %s after order %s: %v", cart.ID, order.ID, err)
+		}
+		return order, nil
+	})
+}
+
+// removeOrderedItems takes the items of ordered, the cart as it was checked
+// out, out of the stored cart. Quantities added since stay in the cart.
+func (s *OrderService) removeOrderedItems(ctx context.Context, ordered *domain.Cart) error {
+	return retryOnConflict(ctx, func() error {
+		cart, err := s.cartRepo.FindByID(ctx, ordered.ID)
+		if err != nil || cart == nil {
+			return err
+		}
+
+		items := cart.Items[:0]
+		for _, item := range cart.Items {
+			if orderedItem := ordered.Item(item.ProductID); orderedItem != nil {
+				item.Quantity -= orderedItem.Quantity
+			}
+			if item.Quantity > 0 {
+				items = append(items, item)
+			}
+		}
+		cart.Items = items
+		return s.cartRepo.Save(ctx, cart)
+	})
+}
+
+// updateCart applies mutate to the cart of the owner and saves it with
+// saveCart. On a version conflict it reloads the cart and applies mutate
+// again, so mutate must only describe the change.
+func (s *OrderService) updateCart(ctx context.Context, userID, guestID, productID string, mutate func(cart *domain.Cart)) (*domain.Cart, error) {
+	var saved *domain.Cart
+	err := retryOnConflict(ctx, func() error {
+		cart, err := s.loadCart(ctx, userID, guestID)
+		if err != nil {
+			return err
+		}
+		mutate(cart)
+		saved, err = s.saveCart(ctx, cart, productID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// loadCart returns the stored cart of the owner or a new empty one.
+func (s *OrderService) loadCart(ctx context.Context, userID, guestID string) (*domain.Cart, error) {
+	id, err := cartID(userID, guestID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.cartRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		cart = &domain.Cart{
+			ID:        id,
+			UserID:    userID,
+			GuestID:   guestID,
+			CreatedAt: time.Now(),
+		}
+	}
+	return cart, nil
+}
+
+// saveCart refreshes the cart from the catalog and saves it. The product just
+// added or updated, if any, must exist. Guest carts expire guestCartTTL after
+// their last change.
+func (s *OrderService) saveCart(ctx context.Context, cart *domain.Cart, productID string) (*domain.Cart, error) {
+	missing, err := s.refreshCart(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range missing {
+		if id == productID {
+			return nil, &ProductError{Err: ErrProductValidation, ProductIDs: []string{id}}
+		}
+	}
+
+	if cart.GuestID != "" && s.guestCartTTL > 0 {
+		expiresAt := time.Now().Add(s.guestCartTTL)
+		cart.ExpiresAt = &expiresAt
+	}
+	if err := s.cartRepo.Save(ctx, cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// refreshCart fills in the current name, price and stock of the cart items
+// and the cart subtotal. It returns the products no longer in the catalog,
+// which stay in the cart as unavailable.
+func (s *OrderService) refreshCart(ctx context.Context, cart *domain.Cart) ([]string, error) {
+	cart.Subtotal = money.Money{}
+	if len(cart.Items) == 0 {
+		return nil, nil
+	}
+
+	productIDs := make([]string, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	resp, err := s.productCli.GetProductDetails(ctx, productIDs)
+	if err != nil {
+		if client.IsUnavailable(err) {
+			return nil, ErrProductUnavailable
+		}
+		return nil, ErrProductValidation
+	}
+
+	details := make(map[string]int, len(resp.Products))
+	for i, p := range resp.Products {
+		details[p.Id] = i
+	}
+
+	var missing []string
+	var subtotal money.Money
+	mixedCurrencies := false
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		j, ok := details[item.ProductID]
+		if !ok || resp.Products[j].Price == nil {
+			item.Available = false
+			missing = append(missing, item.ProductID)
+			continue
+		}
+		p := resp.Products[j]
+
+		item.Name = p.Name
+		item.Price = money.New(p.Price.Amount, money.Currency(p.Price.Currency))
+		item.Stock = int(p.Stock)
+		item.Available = item.Stock >= item.Quantity
+
+		line := item.Price.Mul(int64(item.Quantity))
+		if subtotal.Currency == "" {
+			subtotal = line
+		} else if sum, err := subtotal.Add(line); err == nil {
+			subtotal = sum
+		} else {
+			mixedCurrencies = true
+		}
+	}
+	if !mixedCurrencies {
+		cart.Subtotal = subtotal
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,526 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"order-service/gen/payment"
+	"order-service/gen/product"
+	"order-service/internal/client"
+	"order-service/internal/domain"
+	"order-service/internal/repository"
+	"shared/auth"
+	"shared/outbox"
+)
+
+var (
+	ErrCheckoutInProgress = errors.New("checkout already in progress")
+
+	// errPaymentDeclined is a final answer from the gateway and is not retried.
+	errPaymentDeclined = errors.New("payment declined")
+	// errPaymentPending means the gateway reports the outcome later through a
+	// payment notification.
+	errPaymentPending = errors.New("payment pending")
+	// errChargeUnknown means neither the charge nor the lookup of its payment
+	// got an answer, so the checkout is left to recovery.
+	errChargeUnknown = errors.New("outcome of charge unknown")
+)
+
+const (
+	sagaMaxAttempts   = 3
+	sagaRetryBackoff  = 200 * time.Millisecond
+	sagaRecoveryBatch = 50
+)
+
+type checkoutStep struct {
+	name       domain.SagaStep
+	execute    func(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error
+	compensate func(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error
+	// forwardOnly steps run once the order is confirmed. They are retried by
+	// recovery until they succeed instead of being compensated.
+	forwardOnly bool
+}
+
+func (s *OrderService) checkoutSteps() []checkoutStep {
+	return []checkoutStep{
+		{name: domain.SagaStepReserveStock, execute: s.sagaReserveStock, compensate: s.sagaReleaseStock},
+		{name: domain.SagaStepCharge, execute: s.sagaCharge, compensate: s.sagaRefund},
+		{name: domain.SagaStepConfirm, execute: s.sagaConfirm},
+		{name: domain.SagaStepPublish, execute: s.sagaPublish, forwardOnly: true},
+	}
+}
+
+// startCheckout persists a new checkout saga for the order and runs it.
+func (s *OrderService) startCheckout(ctx context.Context, order *domain.Order, paymentMethod string) (*domain.Order, error) {
+	now := time.Now()
+	saga := &domain.CheckoutSaga{
+		ID:            generateID(),
+		OrderID:       order.ID,
+		PaymentMethod: paymentMethod,
+		Status:        domain.SagaStatusRunning,
+		CurrentStep:   domain.SagaStepReserveStock,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := s.sagaRepo.Create(ctx, saga); err != nil {
+		if errors.Is(err, repository.ErrSagaInProgress) {
+			return nil, ErrCheckoutInProgress
+		}
+		return nil, err
+	}
+
+	return s.runCheckout(ctx, saga, order)
+}
+
+// runCheckout drives the saga forward from its current step, or backward
+// through the compensations of its completed steps once a step has failed.
+// A declined payment returns the failed order without an error.
+func (s *OrderService) runCheckout(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) (*domain.Order, error) {
+	// A checkout must not stop halfway because the caller went away
+	ctx = context.WithoutCancel(ctx)
+	steps := s.checkoutSteps()
+
+	var failure error
+	if saga.Status == domain.SagaStatusRunning {
+		for i := stepIndex(steps, saga.CurrentStep); i < len(steps); i++ {
+			step := steps[i]
+			saga.CurrentStep = step.name
+
+			err := s.runSagaStep(ctx, saga, order, step.execute)
+			if err != nil && step.name == domain.SagaStepCharge && !errors.Is(err, errPaymentDeclined) && !errors.Is(err, errPaymentPending) {
+				// The charge may have gone through without its answer
+				// reaching us
+				err = s.reconcileCharge(ctx, saga, order, err)
+			}
+			if err != nil {
+				if errors.Is(err, errPaymentPending) {
+					return s.awaitPayment(ctx, saga, order)
+				}
+				saga.LastError = err.Error()
+				if step.forwardOnly || errors.Is(err, errChargeUnknown) {
+					log.Printf("checkout %s left at step %s for recovery: %v", saga.ID, step.name, err)
+					if err := s.saveSaga(ctx, saga); err != nil {
+						return nil, err
+					}
+					if step.forwardOnly {
+						return order, nil
+					}
+					return nil, ErrPaymentProcessing
+				}
+				failure = err
+				saga.Status = domain.SagaStatusCompensating
+				if err := s.saveSaga(ctx, saga); err != nil {
+					return nil, err
+				}
+				break
+			}
+
+			saga.CompletedSteps = append(saga.CompletedSteps, step.name)
+			if i == len(steps)-1 {
+				saga.Status = domain.SagaStatusCompleted
+			} else {
+				saga.CurrentStep = steps[i+1].name
+			}
+			if err := s.saveSaga(ctx, saga); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if saga.Status == domain.SagaStatusCompensating {
+		if err := s.compensateCheckout(ctx, saga, order); err != nil {
+			return nil, err
+		}
+		if failure != nil && !errors.Is(failure, errPaymentDeclined) {
+			return nil, failure
+		}
+	}
+
+	return order, nil
+}
+
+// compensateCheckout undoes the completed steps in reverse order and fails
+// the order. It stops at the first compensation that keeps failing, leaving
+// the saga for recovery to retry.
+func (s *OrderService) compensateCheckout(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	steps := s.checkoutSteps()
+
+	for i := len(saga.CompletedSteps) - 1; i >= 0; i-- {
+		step := steps[stepIndex(steps, saga.CompletedSteps[i])]
+		if step.compensate != nil {
+			if err := s.runSagaStep(ctx, saga, order, step.compensate); err != nil {
+				log.Printf("checkout %s failed to compensate step %s: %v", saga.ID, step.name, err)
+				saga.LastError = err.Error()
+				if saveErr := s.saveSaga(ctx, saga); saveErr != nil {
+					return saveErr
+				}
+				return err
+			}
+		}
+
+		saga.CompletedSteps = saga.CompletedSteps[:i]
+		if err := s.saveSaga(ctx, saga); err != nil {
+			return err
+		}
+	}
+
+	// Start from the stored order, a failed step may have changed the copy in
+	// memory without saving it. A save that conflicts starts over from the
+	// stored order again.
+	err := retryOnConflict(ctx, func() error {
+		if err := s.reloadOrder(ctx, order); err != nil {
+			return err
+		}
+		if saga.PaymentID != "" {
+			order.PaymentID = saga.PaymentID
+			order.PaymentURL = saga.PaymentURL
+		}
+
+		save := func(ctx context.Context) error { return nil }
+		if err := order.TransitionTo(domain.OrderStatusFailed, domain.ActorSystem, saga.LastError); err == nil {
+			save = func(ctx context.Context) error {
+				return s.orderRepo.Update(ctx, order)
+			}
+		}
+
+		// Let subscribers know about declined payments
+		if saga.PaymentID != "" {
+			return s.saveWithEvent(ctx, save, "payment.processed", order.ID, domain.PaymentProcessedEvent{
+				OrderID:    order.ID,
+				PaymentID:  saga.PaymentID,
+				Status:     saga.PaymentStatus,
+				Amount:     order.Total,
+				OccurredAt: time.Now(),
+			})
+		}
+		return save(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	saga.Status = domain.SagaStatusCompensated
+	return s.saveSaga(ctx, saga)
+}
+
+// runSagaStep runs fn with a per-attempt timeout, retrying with exponential
+// backoff until it succeeds, is declined or runs out of attempts.
+func (s *OrderService) runSagaStep(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order, fn func(context.Context, *domain.CheckoutSaga, *domain.Order) error) error {
+	backoff := sagaRetryBackoff
+	for attempt := 1; ; attempt++ {
+		saga.Attempts++
+
+		stepCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := fn(stepCtx, saga, order)
+		cancel()
+
+		if err == nil || errors.Is(err, errPaymentDeclined) || errors.Is(err, errPaymentPending) || attempt >= sagaMaxAttempts {
+			return err
+		}
+
+		log.Printf("checkout %s step %s attempt %d failed: %v", saga.ID, saga.CurrentStep, attempt, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// awaitPayment parks the saga at the charge step until the payment
+// notification arrives and marks the order as waiting for its payment.
+func (s *OrderService) awaitPayment(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) (*domain.Order, error) {
+	updateCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.updateOrder(updateCtx, order, func(order *domain.Order) error {
+		order.PaymentID = saga.PaymentID
+		order.PaymentURL = saga.PaymentURL
+		if order.Status == domain.OrderStatusPaymentPending {
+			return nil
+		}
+		return order.TransitionTo(domain.OrderStatusPaymentPending, domain.ActorSystem, "awaiting payment confirmation")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saga.Status = domain.SagaStatusAwaitingPayment
+	if err := s.saveSaga(ctx, saga); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// applyPaymentOutcome moves a saga on from waiting for its payment: a
+// successful payment resumes it at the confirm step, any other outcome
+// compensates it.
+func applyPaymentOutcome(saga *domain.CheckoutSaga, status string) {
+	saga.PaymentStatus = status
+	if status == domain.PaymentStatusSuccess {
+		saga.Status = domain.SagaStatusRunning
+		saga.CompletedSteps = append(saga.CompletedSteps, domain.SagaStepCharge)
+		saga.CurrentStep = domain.SagaStepConfirm
+	} else {
+		saga.Status = domain.SagaStatusCompensating
+		saga.LastError = errPaymentDeclined.Error() + ": " + status
+	}
+}
+
+// reconcileAwaitedPayment asks the payment service for the outcome of a
+// payment whose notification did not arrive in time. It reports whether the
+// saga can go on; a payment that is still pending keeps it waiting.
+func (s *OrderService) reconcileAwaitedPayment(ctx context.Context, saga *domain.CheckoutSaga) (bool, error) {
+	statusCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	statusResp, err := s.paymentCli.GetPaymentStatus(statusCtx, saga.PaymentID)
+	if err != nil {
+		return false, err
+	}
+	if statusResp.Status == domain.PaymentStatusPending {
+		return false, nil
+	}
+
+	log.Printf("checkout %s found payment %s %s without its notification", saga.ID, saga.PaymentID, statusResp.Status)
+	applyPaymentOutcome(saga, statusResp.Status)
+	if err := s.saveSaga(ctx, saga); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *OrderService) saveSaga(ctx context.Context, saga *domain.CheckoutSaga) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if err := s.sagaRepo.Update(ctx, saga); err != nil {
+		log.Printf("failed to save checkout %s: %v", saga.ID, err)
+		return err
+	}
+	return nil
+}
+
+// RunCheckoutRecovery resumes checkouts left unfinished by a crashed or
+// restarted instance every interval until ctx is done. Checkouts not saved
+// for staleAfter are considered abandoned. Checkouts still waiting for their
+// payment notification after paymentDeadline are settled with the payment
+// status the payment service reports.
+func (s *OrderService) RunCheckoutRecovery(ctx context.Context, interval, staleAfter, paymentDeadline time.Duration) {
+	ctx = auth.NewInternalContext(ctx, "checkout-recovery")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.recoverCheckouts(ctx, staleAfter, paymentDeadline)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *OrderService) recoverCheckouts(ctx context.Context, staleAfter, paymentDeadline time.Duration) {
+	now := time.Now()
+	sagas, err := s.sagaRepo.FindStale(ctx, now.Add(-staleAfter), now.Add(-paymentDeadline), sagaRecoveryBatch)
+	if err != nil {
+		log.Printf("failed to find stale checkouts: %v", err)
+		return
+	}
+
+	for i := range sagas {
+		saga := &sagas[i]
+
+		// Another instance may be recovering the same checkout
+		claimed, err := s.sagaRepo.Claim(ctx, saga)
+		if err != nil || !claimed {
+			continue
+		}
+
+		order, err := s.orderRepo.FindByID(ctx, saga.OrderID)
+		if err != nil || order == nil {
+			log.Printf("failed to load order %s of checkout %s: %v", saga.OrderID, saga.ID, err)
+			continue
+		}
+
+		if saga.Status == domain.SagaStatusAwaitingPayment {
+			settled, err := s.reconcileAwaitedPayment(ctx, saga)
+			if err != nil {
+				log.Printf("failed to look up payment %s of checkout %s: %v", saga.PaymentID, saga.ID, err)
+			}
+			if !settled {
+				continue
+			}
+		}
+
+		log.Printf("resuming checkout %s of order %s at step %s (%s)", saga.ID, order.ID, saga.CurrentStep, saga.Status)
+		if _, err := s.runCheckout(ctx, saga, order); err != nil {
+			log.Printf("recovered checkout %s failed: %v", saga.ID, err)
+		}
+	}
+}
+
+// Saga steps
+
+// sagaReserveStock makes sure the order holds stock while it is charged.
+// Orders keep their reservation from CreateOrder until a payment fails, and
+// reserving again extends it, or replaces it when it ran out before the
+// order was paid.
+func (s *OrderService) sagaReserveStock(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	previous := order.ReservationID
+	if err := s.reserveStock(ctx, order); err != nil {
+		return err
+	}
+	if order.ReservationID == previous {
+		return nil
+	}
+	reservationID := order.ReservationID
+	err := s.updateOrder(ctx, order, func(order *domain.Order) error {
+		order.ReservationID = reservationID
+		return nil
+	})
+	if err != nil {
+		if releaseErr := s.releaseReservation(ctx, order); releaseErr != nil {
+			log.Printf("failed to release reservation of order %s: %v", order.ID, releaseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *OrderService) sagaReleaseStock(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	if saga.StockCommitted {
+		// Committed stock is no longer a reservation and goes back directly
+		if err := s.updateStock(ctx, order.Items, product.StockOperation_STOCK_OPERATION_INCREASE); err != nil {
+			return err
+		}
+		saga.StockCommitted = false
+		order.ReservationID = ""
+	} else if err := s.releaseReservation(ctx, order); err != nil {
+		return err
+	}
+
+	return s.updateOrder(ctx, order, clearReservation)
+}
+
+func (s *OrderService) sagaCharge(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	paymentResp, err := s.paymentCli.CreatePayment(ctx, &payment.PaymentRequest{
+		OrderId:        order.ID,
+		UserId:         order.UserID,
+		Amount:         toPaymentMoney(order.Total),
+		PaymentMethod:  saga.PaymentMethod,
+		IdempotencyKey: saga.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentProcessing, err)
+	}
+
+	return applyCharge(saga, order, paymentResp.PaymentId, paymentResp.PaymentUrl, paymentResp.Status)
+}
+
+// reconcileCharge looks up the payment of the saga by its idempotency key
+// after charging failed without an answer, and continues from what actually
+// happened. It returns chargeErr when no payment was created, so the checkout
+// is compensated, and errChargeUnknown when the payment service cannot tell.
+func (s *OrderService) reconcileCharge(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order, chargeErr error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	statusResp, err := s.paymentCli.GetPaymentStatusByKey(ctx, saga.ID)
+	if client.IsNotFound(err) {
+		return chargeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errChargeUnknown, err)
+	}
+
+	log.Printf("checkout %s found payment %s (%s) after charging failed: %v", saga.ID, statusResp.PaymentId, statusResp.Status, chargeErr)
+	return applyCharge(saga, order, statusResp.PaymentId, statusResp.PaymentUrl, statusResp.Status)
+}
+
+// applyCharge records the payment on the saga and the order and turns its
+// status into the outcome of the charge step.
+func applyCharge(saga *domain.CheckoutSaga, order *domain.Order, paymentID, paymentURL, status string) error {
+	saga.PaymentID = paymentID
+	saga.PaymentURL = paymentURL
+	saga.PaymentStatus = status
+	order.PaymentID = paymentID
+	order.PaymentURL = paymentURL
+
+	switch status {
+	case domain.PaymentStatusSuccess:
+		return nil
+	case domain.PaymentStatusPending:
+		return errPaymentPending
+	default:
+		return fmt.Errorf("%w: %s", errPaymentDeclined, status)
+	}
+}
+
+func (s *OrderService) sagaRefund(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	if saga.PaymentStatus != domain.PaymentStatusSuccess {
+		return nil
+	}
+
+	refundResp, err := s.paymentCli.ProcessRefund(ctx, &payment.RefundRequest{
+		PaymentId:      saga.PaymentID,
+		OrderId:        order.ID,
+		Amount:         toPaymentMoney(order.Total),
+		Reason:         "checkout failed: " + saga.LastError,
+		IdempotencyKey: saga.ID + ":refund",
+	})
+	if err != nil || refundResp.Status == domain.PaymentStatusFailed {
+		return ErrRefundProcessing
+	}
+
+	saga.PaymentStatus = domain.PaymentStatusRefunded
+	return nil
+}
+
+func (s *OrderService) sagaConfirm(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	if order.ReservationID != "" && !saga.StockCommitted {
+		if err := s.commitReservation(ctx, order); err != nil {
+			return err
+		}
+		saga.StockCommitted = true
+	}
+
+	return s.updateOrder(ctx, order, func(order *domain.Order) error {
+		order.PaymentID = saga.PaymentID
+		order.PaymentURL = saga.PaymentURL
+		if order.Status == domain.OrderStatusPaid {
+			return nil
+		}
+		return order.TransitionTo(domain.OrderStatusPaid, domain.ActorSystem, "payment succeeded")
+	})
+}
+
+// sagaPublish hands the PaymentProcessed event to the outbox relay.
+func (s *OrderService) sagaPublish(ctx context.Context, saga *domain.CheckoutSaga, order *domain.Order) error {
+	message, err := outbox.NewMessage("payment.processed", order.ID, domain.PaymentProcessedEvent{
+		OrderID:    order.ID,
+		PaymentID:  saga.PaymentID,
+		Status:     saga.PaymentStatus,
+		Amount:     order.Total,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return s.outboxRepo.Add(ctx, message)
+}
+
+func stepIndex(steps []checkoutStep, name domain.SagaStep) int {
+	for i, step := range steps {
+		if step.name == name {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"order-service/internal/domain"
+)
+
+func TestCheckoutStepsCompensation(t *testing.T) {
+	steps := (&OrderService{}).checkoutSteps()
+
+	tests := []struct {
+		step           domain.SagaStep
+		wantIndex      int
+		wantCompensate bool
+		wantForward    bool
+	}{
+		{domain.SagaStepReserveStock, 0, true, false},
+		{domain.SagaStepCharge, 1, true, false},
+		{domain.SagaStepConfirm, 2, false, false},
+		{domain.SagaStepPublish, 3, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.step), func(t *testing.T) {
+			i := stepIndex(steps, tt.step)
+			if i != tt.wantIndex {
+				t.Fatalf("stepIndex() = %d, want %d", i, tt.wantIndex)
+			}
+			if got := steps[i].compensate != nil; got != tt.wantCompensate {
+				t.Errorf("compensate set = %v, want %v", got, tt.wantCompensate)
+			}
+			if steps[i].forwardOnly != tt.wantForward {
+				t.Errorf("forwardOnly = %v, want %v", steps[i].forwardOnly, tt.wantForward)
+			}
+		})
+	}
+}
+
+func TestApplyCharge(t *testing.T) {
+	tests := []struct {
+		status  string
+		wantErr error
+	}{
+		{domain.PaymentStatusSuccess, nil},
+		{domain.PaymentStatusPending, errPaymentPending},
+		{domain.PaymentStatusFailed, errPaymentDeclined},
+		{"cancelled", errPaymentDeclined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			saga := &domain.CheckoutSaga{}
+			order := &domain.Order{}
+
+			err := applyCharge(saga, order, "pay-1", "https://pay/1", tt.status)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyCharge() error = %v, want %v", err, tt.wantErr)
+			}
+			if saga.PaymentID != "pay-1" || order.PaymentID != "pay-1" {
+				t.Errorf("PaymentID = %q on the saga and %q on the order, want pay-1", saga.PaymentID, order.PaymentID)
+			}
+			if saga.PaymentStatus != tt.status {
+				t.Errorf("PaymentStatus = %q, want %q", saga.PaymentStatus, tt.status)
+			}
+		})
+	}
+}
+
+func TestApplyPaymentOutcome(t *testing.T) {
+	tests := []struct {
+		status        string
+		wantStatus    domain.SagaStatus
+		wantStep      domain.SagaStep
+		wantCompleted []domain.SagaStep
+	}{
+		{
+			status:        domain.PaymentStatusSuccess,
+			wantStatus:    domain.SagaStatusRunning,
+			wantStep:      domain.SagaStepConfirm,
+			wantCompleted: []domain.SagaStep{domain.SagaStepReserveStock, domain.SagaStepCharge},
+		},
+		{
+			status:        domain.PaymentStatusFailed,
+			wantStatus:    domain.SagaStatusCompensating,
+			wantStep:      domain.SagaStepCharge,
+			wantCompleted: []domain.SagaStep{domain.SagaStepReserveStock},
+		},
+		{
+			status:        "expired",
+			wantStatus:    domain.SagaStatusCompensating,
+			wantStep:      domain.SagaStepCharge,
+			wantCompleted: []domain.SagaStep{domain.SagaStepReserveStock},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			saga := &domain.CheckoutSaga{
+				Status:         domain.SagaStatusAwaitingPayment,
+				CurrentStep:    domain.SagaStepCharge,
+				CompletedSteps: []domain.SagaStep{domain.SagaStepReserveStock},
+			}
+
+			applyPaymentOutcome(saga, tt.status)
+			if saga.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", saga.Status, tt.wantStatus)
+			}
+			if saga.CurrentStep != tt.wantStep {
+				t.Errorf("CurrentStep = %s, want %s", saga.CurrentStep, tt.wantStep)
+			}
+			if len(saga.CompletedSteps) != len(tt.wantCompleted) {
+				t.Fatalf("CompletedSteps = %v, want %v", saga.CompletedSteps, tt.wantCompleted)
+			}
+			for i := range saga.CompletedSteps {
+				if saga.CompletedSteps[i] != tt.wantCompleted[i] {
+					t.Errorf("CompletedSteps[%d] = %s, want %s", i, saga.CompletedSteps[i], tt.wantCompleted[i])
+				}
+			}
+			if tt.wantStatus == domain.SagaStatusCompensating && saga.LastError == "" {
+				t.Error("LastError is empty for a compensating saga")
+			}
+		})
+	}
+}
+
+func TestSagaRefundSkipsPaymentsNotTaken(t *testing.T) {
+	tests := []string{
+		"",
+		domain.PaymentStatusPending,
+		domain.PaymentStatusFailed,
+		domain.PaymentStatusRefunded,
+	}
+	for _, status := range tests {
+		t.Run(status, func(t *testing.T) {
+			s := &OrderService{}
+			saga := &domain.CheckoutSaga{PaymentID: "pay-1", PaymentStatus: status}
+
+			if err := s.sagaRefund(context.Background(), saga, &domain.Order{}); err != nil {
+				t.Fatalf("sagaRefund() error = %v", err)
+			}
+			if saga.PaymentStatus != status {
+				t.Errorf("PaymentStatus = %q, want %q", saga.PaymentStatus, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"order-service/internal/domain"
+	"order-service/internal/repository"
+)
+
+const (
+	conflictMaxAttempts = 5
+	conflictBackoff     = 20 * time.Millisecond
+)
+
+// retryOnConflict runs fn until it saves without a version conflict or runs
+// out of attempts. fn must start from the stored order on every attempt, e.g.
+// by reloading it, or it conflicts again.
+func retryOnConflict(ctx context.Context, fn func() error) error {
+	backoff := conflictBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, repository.ErrConflict) || attempt >= conflictMaxAttempts {
+			return err
+		}
+
+		// Jitter keeps the writers that collided from colliding again
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff *= 2
+	}
+}
+
+// updateOrder applies mutate to the order and saves it. On a version conflict
+// it reloads the order, applies mutate again and retries, so mutate must only
+// describe the change, not depend on the copy it was first given. The order
+// ends up as saved.
+func (s *OrderService) updateOrder(ctx context.Context, order *domain.Order, mutate func(order *domain.Order) error) error {
+	first := true
+	return retryOnConflict(ctx, func() error {
+		if !first {
+			if err := s.reloadOrder(ctx, order); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if err := mutate(order); err != nil {
+			return err
+		}
+		return s.orderRepo.Update(ctx, order)
+	})
+}
+
+// reloadOrder replaces the order with its stored version.
+func (s *OrderService) reloadOrder(ctx context.Context, order *domain.Order) error {
+	stored, err := s.orderRepo.FindByID(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrOrderNotFound
+	}
+	*order = *stored
+	return nil
+}
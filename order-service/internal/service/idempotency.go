@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"order-service/internal/domain"
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	ErrRequestInProgress    = errors.New("a request with this idempotency key is still in progress")
+)
+
+// idempotencyLock is how long a request holds its key before a retry may take
+// over, in case the instance handling it died.
+const idempotencyLock = time.Minute
+
+const (
+	operationCreateOrder    = "create_order"
+	operationProcessPayment = "process_payment"
+	operationCheckout       = "checkout"
+)
+
+// idempotent runs fn at most once per user, operation and key and replays the
+// stored response for retries. Reusing a key for a different request is a
+// conflict. Failed requests are forgotten so that they can be retried with
+// the same key. An empty key runs fn unconditionally.
+func (s *OrderService) idempotent(ctx context.Context, userID, operation, key string, request interface{}, fn func() (*domain.Order, error)) (*domain.Order, error) {
+	if key == "" {
+		return fn()
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(requestJSON)
+
+	now := time.Now()
+	record := &domain.IdempotencyRecord{
+		ID:          userID + ":" + operation + ":" + key,
+		UserID:      userID,
+		Operation:   operation,
+		Key:         key,
+		RequestHash: hex.EncodeToString(hash[:]),
+		Status:      domain.IdempotencyStatusInProgress,
+		LockedUntil: now.Add(idempotencyLock),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.idempotencyTTL),
+	}
+
+	existing, err := s.idempotencyRepo.Begin(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.RequestHash != record.RequestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if existing.Status == domain.IdempotencyStatusCompleted {
+			var order domain.Order
+			if err := json.Unmarshal(existing.Response, &order); err != nil {
+				return nil, err
+			}
+			return &order, nil
+		}
+
+		reclaimed, err := s.idempotencyRepo.Reclaim(ctx, record.ID, now, record.LockedUntil)
+		if err != nil {
+			return nil, err
+		}
+		if !reclaimed {
+			return nil, ErrRequestInProgress
+		}
+	}
+
+	order, err := fn()
+	if err != nil {
+		if delErr := s.idempotencyRepo.Delete(ctx, record.ID); delErr != nil {
+			log.Printf("failed to forget idempotency key %s: %v", record.ID, delErr)
+		}
+		return nil, err
+	}
+
+	response, err := json.Marshal(order)
+	if err == nil {
+		err = s.idempotencyRepo.Complete(ctx, record.ID, response)
+	}
+	if err != nil {
+		log.Printf("failed to store response for idempotency key %s: %v", record.ID, err)
+	}
+
+	return order, nil
+}
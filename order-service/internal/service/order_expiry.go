@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"order-service/internal/domain"
+	"order-service/internal/repository"
+	"shared/auth"
+)
+
+const (
+	orderExpiryBatch  = 100
+	orderExpiryReason = "not paid in time"
+)
+
+// RunOrderExpiry cancels orders not paid within ttl of their creation every
+// interval until ctx is done: pending orders, orders whose payment failed and
+// orders left waiting for a payment that never completed. Every replica may
+// run it: each order is claimed before it is expired, so it is expired once.
+func (s *OrderService) RunOrderExpiry(ctx context.Context, interval, ttl time.Duration) {
+	ctx = auth.NewInternalContext(ctx, "order-expiry")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.expireOrders(ctx, ttl)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *OrderService) expireOrders(ctx context.Context, ttl time.Duration) {
+	orders, err := s.orderRepo.FindUnpaidBefore(ctx, time.Now().Add(-ttl), orderExpiryBatch)
+	if err != nil {
+		log.Printf("failed to find expired orders: %v", err)
+		return
+	}
+
+	for i := range orders {
+		if err := s.expireOrder(ctx, &orders[i]); err != nil {
+			log.Printf("failed to expire order %s: %v", orders[i].ID, err)
+		}
+	}
+}
+
+// expireOrder cancels an unpaid order, publishes OrderExpired and releases its
+// stock reservation. Orders whose payment succeeded or is still pending at
+// the payment service are left alone.
+func (s *OrderService) expireOrder(ctx context.Context, order *domain.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	// Another instance may be expiring the order, or the user acting on it. A
+	// conflict on save means the same, the next sweep looks at it again.
+	claimed, err := s.orderRepo.Claim(ctx, order)
+	if err != nil || !claimed {
+		return err
+	}
+
+	// Leave orders whose checkout is running to the checkout
+	saga, err := s.sagaRepo.FindActiveByOrderID(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if saga != nil {
+		return nil
+	}
+
+	// The outcome of the last payment may not have reached the order
+	if order.PaymentID != "" {
+		statusResp, err := s.paymentCli.GetPaymentStatus(ctx, order.PaymentID)
+		if err != nil {
+			return err
+		}
+		if statusResp.Status == domain.PaymentStatusSuccess || statusResp.Status == domain.PaymentStatusPending {
+			log.Printf("not expiring order %s, its payment %s is %s", order.ID, order.PaymentID, statusResp.Status)
+			return nil
+		}
+	}
+
+	if err := order.TransitionTo(domain.OrderStatusCancelled, domain.ActorSystem, orderExpiryReason); err != nil {
+		return err
+	}
+
+	// Save the order together with its OrderExpired event
+	err = s.saveWithEvent(ctx, func(ctx context.Context) error {
+		return s.orderRepo.Update(ctx, order)
+	}, "order.expired", order.ID, domain.OrderExpiredEvent{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Items:     order.Items,
+		ExpiredAt: order.UpdatedAt,
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Reservations also expire on their own in product-service, so a failed
+	// release only holds the stock a little longer
+	if order.ReservationID != "" {
+		if err := s.releaseReservation(ctx, order); err != nil {
+			log.Printf("failed to release reservation of expired order %s: %v", order.ID, err)
+		} else if err := s.updateOrder(ctx, order, clearReservation); err != nil {
+			log.Printf("failed to clear reservation of expired order %s: %v", order.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -2,94 +2,260 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"order-service/gen/payment"
 	"order-service/gen/product"
+	"order-service/internal/client"
 	"order-service/internal/domain"
 	"order-service/internal/repository"
-	"order-service/pkg/eventbus"
+	"shared/money"
+	"shared/outbox"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrInvalidOrder      = errors.New("invalid order")
-	ErrProductValidation = errors.New("product validation failed")
-	ErrPaymentProcessing = errors.New("payment processing failed")
-	ErrOrderNotFound     = errors.New("order not found")
+	ErrInvalidOrder       = errors.New("invalid order")
+	ErrProductValidation  = errors.New("product validation failed")
+	ErrStockReservation   = errors.New("stock reservation failed")
+	ErrPaymentProcessing  = errors.New("payment processing failed")
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrInvalidPageToken   = errors.New("invalid page token")
+	ErrRefundProcessing   = errors.New("refund processing failed")
+	ErrProductUnavailable = errors.New("product service unavailable")
+)
+
+// ProductError names the products that made an order operation fail. It
+// matches its underlying error, e.g. ErrStockReservation, with errors.Is.
+type ProductError struct {
+	Err        error
+	ProductIDs []string
+}
+
+func (e *ProductError) Error() string {
+	if len(e.ProductIDs) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(e.ProductIDs, ", "))
+}
+
+func (e *ProductError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
 type OrderService struct {
-	orderRepo  repository.OrderRepository
-	productCli *client.ProductClient
-	paymentCli *client.PaymentClient
-	eventBus   eventbus.EventBus
-	timeout    time.Duration
+	orderRepo        repository.OrderRepository
+	sagaRepo         repository.SagaRepository
+	outboxRepo       outbox.Repository
+	idempotencyRepo  repository.IdempotencyRepository
+	promotionRepo    repository.PromotionRepository
+	cartRepo         repository.CartRepository
+	subscriptionRepo repository.SubscriptionRepository
+	transactor       repository.Transactor
+	productCli       *client.ProductClient
+	paymentCli       *client.PaymentClient
+
+	priceMismatchPolicy PriceMismatchPolicy
+	taxes               TaxTable
+	shipping            ShippingCalculator
+	commissionRate      int64
+	reservationTTL      time.Duration
+	idempotencyTTL      time.Duration
+	guestCartTTL        time.Duration
+	notificationSecret  []byte
+	timeout             time.Duration
 }
 
 func NewOrderService(
 	orderRepo repository.OrderRepository,
+	sagaRepo repository.SagaRepository,
+	outboxRepo outbox.Repository,
+	idempotencyRepo repository.IdempotencyRepository,
+	promotionRepo repository.PromotionRepository,
+	cartRepo repository.CartRepository,
+	subscriptionRepo repository.SubscriptionRepository,
+	transactor repository.Transactor,
 	productCli *client.ProductClient,
 	paymentCli *client.PaymentClient,
-	eventBus eventbus.EventBus,
+	priceMismatchPolicy PriceMismatchPolicy,
+	taxes TaxTable,
+	shipping ShippingCalculator,
+	commissionRate int64,
+	reservationTTL time.Duration,
+	idempotencyTTL time.Duration,
+	guestCartTTL time.Duration,
+	notificationSecret []byte,
 	timeout time.Duration,
 ) *OrderService {
 	return &OrderService{
-		orderRepo:  orderRepo,
-		productCli: productCli,
-		paymentCli: paymentCli,
-		eventBus:   eventBus,
-		timeout:    timeout,
+		orderRepo:        orderRepo,
+		sagaRepo:         sagaRepo,
+		outboxRepo:       outboxRepo,
+		idempotencyRepo:  idempotencyRepo,
+		promotionRepo:    promotionRepo,
+		cartRepo:         cartRepo,
+		subscriptionRepo: subscriptionRepo,
+		transactor:       transactor,
+		productCli:       productCli,
+		paymentCli:       paymentCli,
+
+		priceMismatchPolicy: priceMismatchPolicy,
+		taxes:               taxes,
+		shipping:            shipping,
+		commissionRate:      commissionRate,
+		reservationTTL:      reservationTTL,
+		idempotencyTTL:      idempotencyTTL,
+		guestCartTTL:        guestCartTTL,
+		notificationSecret:  notificationSecret,
+		timeout:             timeout,
 	}
 }
 
-func (s *OrderService) CreateOrder(ctx context.Context, userID string, items []domain.OrderItem) (*domain.Order, error) {
+// CreateOrder creates a pending order priced from the catalog, discounted by
+// the promotions it qualifies for, taxed for its destination, split into a
+// sub-order per seller and charged for shipping. An empty currency takes the
+// currency the items are priced in. Retries with the same idempotency key
+// return the order created by the first request.
+func (s *OrderService) CreateOrder(ctx context.Context, userID string, currency money.Currency, items []domain.OrderItem, delivery domain.Delivery, couponCode, idempotencyKey string) (*domain.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
+	request := struct {
+		Currency   money.Currency
+		Items      []domain.OrderItem
+		Delivery   domain.Delivery
+		CouponCode string
+	}{currency, items, delivery, couponCode}
+
+	return s.idempotent(ctx, userID, operationCreateOrder, idempotencyKey, request, func() (*domain.Order, error) {
+		return s.createOrder(ctx, userID, currency, items, delivery, couponCode)
+	})
+}
+
+func (s *OrderService) createOrder(ctx context.Context, userID string, currency money.Currency, items []domain.OrderItem, delivery domain.Delivery, couponCode string) (*domain.Order, error) {
 	// Validate input
 	if userID == "" || len(items) == 0 {
 		return nil, ErrInvalidOrder
 	}
+	for _, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return nil, ErrInvalidOrder
+		}
+	}
 
-	// Validate product stock
-	if err := s.validateProducts(ctx, items); err != nil {
+	// Price the items from the catalog, never from the request
+	items, currency, priceMismatch, err := s.priceItems(ctx, items, currency)
+	if err != nil {
 		return nil, err
 	}
 
 	// Calculate total
-	total := calculateTotal(items)
+	subtotal, err := calculateTotal(items, currency)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create order
+	now := time.Now()
 	order := &domain.Order{
-		ID:        generateID(),
-		UserID:    userID,
-		Items:     items,
-		Total:     total,
-		Status:    domain.OrderStatusPending,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:       generateID(),
+		UserID:   userID,
+		Items:    items,
+		Subtotal: subtotal,
+		Total:    subtotal,
+		Status:   domain.OrderStatusPending,
+		StatusHistory: []domain.StatusChange{{
+			To:     domain.OrderStatusPending,
+			Actor:  userID,
+			Reason: "order created",
+			At:     now,
+		}},
+		PriceMismatch: priceMismatch,
+		RefundedTotal: money.Zero(currency),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	// Set the addresses the order is shipped and billed to
+	if err := applyDelivery(order, delivery); err != nil {
+		return nil, err
+	}
+
+	// Apply discounts
+	promotions, err := s.applyPromotions(ctx, order, couponCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply tax on the discounted prices
+	if err := s.applyTax(order); err != nil {
+		return nil, err
+	}
+
+	// Split the order by seller and charge each seller's shipping on the
+	// discounted amount
+	if err := s.splitOrder(order); err != nil {
+		return nil, err
+	}
+	if err := s.applyShipping(ctx, order); err != nil {
+		return nil, err
 	}
 
-	if err := s.orderRepo.Create(ctx, order); err != nil {
+	// Hold the items until the order is paid
+	if err := s.reserveStock(ctx, order); err != nil {
 		return nil, err
 	}
 
-	// Publish OrderCreated event
-	go s.eventBus.Publish("order.created", domain.OrderCreatedEvent{
+	// Save the order together with its OrderCreated event and the use of its
+	// promotions
+	err = s.saveWithEvent(ctx, func(ctx context.Context) error {
+		for i := range promotions {
+			if err := s.promotionRepo.Redeem(ctx, &promotions[i], order.UserID); err != nil {
+				if errors.Is(err, repository.ErrPromotionLimitReached) {
+					return ErrPromotionUsedUp
+				}
+				return err
+			}
+		}
+		return s.orderRepo.Create(ctx, order)
+	}, "order.created", order.ID, domain.OrderCreatedEvent{
 		OrderID:   order.ID,
 		UserID:    order.UserID,
 		Items:     order.Items,
+		Subtotal:  order.Subtotal,
+		Discounts: order.Discounts,
+		TaxTotal:  order.TaxTotal,
+		Shipping:  order.ShippingCost,
 		Total:     order.Total,
+		SubOrders: order.SubOrders,
 		CreatedAt: order.CreatedAt,
 	})
+	if err != nil {
+		if releaseErr := s.releaseReservation(ctx, order); releaseErr != nil {
+			log.Printf("failed to release reservation of order %s: %v", order.ID, releaseErr)
+		}
+		return nil, err
+	}
 
 	return order, nil
 }
 
-func (s *OrderService) ProcessPayment(ctx context.Context, orderID, paymentMethod string) (*domain.Order, error) {
+// ProcessPayment runs the checkout of an order. Retries with the same
+// idempotency key return the result of the first request without charging
+// again.
+func (s *OrderService) ProcessPayment(ctx context.Context, orderID, paymentMethod, idempotencyKey string) (*domain.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
@@ -101,50 +267,278 @@ func (s *OrderService) ProcessPayment(ctx context.Context, orderID, paymentMetho
 	if order == nil {
 		return nil, ErrOrderNotFound
 	}
+	if err := authorizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+
+	request := struct {
+		OrderID       string
+		PaymentMethod string
+	}{orderID, paymentMethod}
+
+	return s.idempotent(ctx, order.UserID, operationProcessPayment, idempotencyKey, request, func() (*domain.Order, error) {
+		if !order.Status.CanTransitionTo(domain.OrderStatusPaid) {
+			return nil, domain.ErrInvalidStatusTransition
+		}
 
-	// Process payment via Payment Service
-	paymentResp, err := s.paymentCli.CreatePayment(ctx, &payment.PaymentRequest{
-		OrderId:       order.ID,
-		UserId:        order.UserID,
-		Amount:        order.Total,
-		Currency:      "USD",
-		PaymentMethod: paymentMethod,
+		// Make sure a previous checkout is not still running
+		active, err := s.sagaRepo.FindActiveByOrderID(ctx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		if active != nil {
+			return nil, ErrCheckoutInProgress
+		}
+
+		return s.startCheckout(ctx, order, paymentMethod)
 	})
+}
+
+// CancelOrder cancels a pending or paid order. Paid orders are refunded in
+// full and their items are returned to stock, unpaid orders release their
+// stock reservation. A paid order records its refund pending and is cancelled
+// once the refund is paid, see RefundOrder.
+func (s *OrderService) CancelOrder(ctx context.Context, orderID, actor, reason string) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if actor == "" {
+		actor = domain.ActorSystem
+	}
+
+	order, err := s.orderRepo.FindByID(ctx, orderID)
 	if err != nil {
-		// Update order status to failed
-		order.Status = domain.OrderStatusFailed
-		s.orderRepo.Update(ctx, order)
-		return nil, ErrPaymentProcessing
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if err := authorizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	if err := s.payPendingRefunds(ctx, order); err != nil {
+		return nil, err
 	}
 
-	// Update order with payment details
-	order.PaymentID = paymentResp.PaymentId
-	order.PaymentURL = paymentResp.PaymentUrl
+	// Start over from the stored order when another update wins the race
+	refundID := uuid.New().String()
+	var refunding bool
+	err = retryOnConflict(ctx, func() error {
+		var err error
+		order, refunding, err = s.cancelOrder(ctx, orderID, refundID, actor, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if paymentResp.Status == "success" {
-		order.Status = domain.OrderStatusPaid
-	} else {
-		order.Status = domain.OrderStatusFailed
+	// The refund cancels the order and restocks its items once it is paid
+	if refunding {
+		if err := s.payRefund(ctx, order, refundID); err != nil {
+			return nil, err
+		}
+		return order, nil
 	}
 
-	if err := s.orderRepo.Update(ctx, order); err != nil {
-		return nil, err
+	if order.ReservationID != "" {
+		if err := s.releaseReservation(ctx, order); err != nil {
+			log.Printf("failed to release reservation of cancelled order %s: %v", order.ID, err)
+		} else if err := s.updateOrder(ctx, order, clearReservation); err != nil {
+			log.Printf("failed to clear reservation of cancelled order %s: %v", order.ID, err)
+		}
+	}
+
+	return order, nil
+}
+
+// cancelOrder cancels the stored order and saves it. A paid order instead
+// records the refund of what is left of its payment under refundID, and
+// cancelOrder reports that the order is being refunded.
+func (s *OrderService) cancelOrder(ctx context.Context, orderID, refundID, actor, reason string) (*domain.Order, bool, error) {
+	order, err := s.orderRepo.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, false, err
+	}
+	if order == nil {
+		return nil, false, ErrOrderNotFound
+	}
+	if err := order.CheckTransition(domain.OrderStatusCancelled); err != nil {
+		return nil, false, err
+	}
+
+	// Refund what is left of the payment before giving up the order
+	wasPaid := order.Status == domain.OrderStatusPaid
+	if items := unrefundedItems(order); wasPaid && len(items) > 0 {
+		if err := recordRefund(order, refundID, items, actor, reason, true); err != nil {
+			return nil, false, err
+		}
+		if err := s.orderRepo.Update(ctx, order); err != nil {
+			return nil, false, err
+		}
+		return order, true, nil
+	}
+
+	if err := order.TransitionTo(domain.OrderStatusCancelled, actor, reason); err != nil {
+		return nil, false, err
 	}
 
-	// Publish PaymentProcessed event
-	go s.eventBus.Publish("payment.processed", domain.PaymentProcessedEvent{
-		OrderID:    order.ID,
-		PaymentID:  paymentResp.PaymentId,
-		Status:     paymentResp.Status,
-		Amount:     order.Total,
-		OccurredAt: time.Now(),
+	// Save the order together with its OrderCancelled event
+	err = s.saveWithEvent(ctx, func(ctx context.Context) error {
+		return s.orderRepo.Update(ctx, order)
+	}, "order.cancelled", order.ID, domain.OrderCancelledEvent{
+		OrderID:     order.ID,
+		UserID:      order.UserID,
+		Items:       order.Items,
+		Refunded:    wasPaid,
+		Reason:      reason,
+		CancelledAt: order.UpdatedAt,
 	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return order, false, nil
+}
+
+// GetOrder returns an order. Users may only read their own orders.
+func (s *OrderService) GetOrder(ctx context.Context, orderID string) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	order, err := s.orderRepo.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if err := authorizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
 
 	return order, nil
 }
 
+// ListOrders returns a page of the user's orders, newest first, together with
+// the token for the next page. The token is empty on the last page.
+func (s *OrderService) ListOrders(ctx context.Context, userID string, statuses []domain.OrderStatus, pageSize int, pageToken string) ([]domain.Order, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if userID == "" {
+		return nil, "", ErrInvalidOrder
+	}
+
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	filter := domain.OrderFilter{
+		UserID:   userID,
+		Statuses: statuses,
+		// Fetch one extra order to know whether another page exists
+		Limit: int64(pageSize + 1),
+	}
+	if pageToken != "" {
+		cursor, err := decodePageToken(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		filter.After = cursor
+	}
+
+	orders, err := s.orderRepo.List(ctx, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		last := orders[len(orders)-1]
+		nextPageToken = encodePageToken(domain.OrderCursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		})
+	}
+
+	return orders, nextPageToken, nil
+}
+
 // Helper functions
-func (s *OrderService) validateProducts(ctx context.Context, items []domain.OrderItem) error {
+
+// saveWithEvent runs save and stores the event in the outbox in one
+// transaction, so the event is published if and only if the change is saved.
+// Events with the same key, the ID of the order or subscription, are
+// published in order.
+func (s *OrderService) saveWithEvent(ctx context.Context, save func(ctx context.Context) error, topic, key string, event interface{}) error {
+	message, err := outbox.NewMessage(topic, key, event)
+	if err != nil {
+		return err
+	}
+
+	return s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := save(ctx); err != nil {
+			return err
+		}
+		return s.outboxRepo.Add(ctx, message)
+	})
+}
+
+// reserveStock holds the order's items in product-service and records the
+// reservation on the order.
+func (s *OrderService) reserveStock(ctx context.Context, order *domain.Order) error {
+	resp, err := s.productCli.ReserveStock(ctx, order.ID, toProductItems(order.Items), s.reservationTTL)
+	if err != nil {
+		log.Printf("failed to reserve stock for order %s: %v", order.ID, err)
+		if client.IsUnavailable(err) {
+			return ErrProductUnavailable
+		}
+		return &ProductError{Err: ErrStockReservation, ProductIDs: client.FailedProducts(err)}
+	}
+
+	order.ReservationID = resp.ReservationId
+	return nil
+}
+
+// commitReservation makes the order's reserved stock permanent.
+func (s *OrderService) commitReservation(ctx context.Context, order *domain.Order) error {
+	if order.ReservationID == "" {
+		return nil
+	}
+	_, err := s.productCli.CommitReservation(ctx, order.ReservationID)
+	return err
+}
+
+// releaseReservation gives the order's reserved stock back and forgets the
+// reservation. A reservation that cannot be released runs out on its own.
+func (s *OrderService) releaseReservation(ctx context.Context, order *domain.Order) error {
+	if order.ReservationID == "" {
+		return nil
+	}
+	if _, err := s.productCli.ReleaseReservation(ctx, order.ReservationID); err != nil {
+		return err
+	}
+	order.ReservationID = ""
+	return nil
+}
+
+// clearReservation is an updateOrder mutation for orders whose reservation
+// was released.
+func clearReservation(order *domain.Order) error {
+	order.ReservationID = ""
+	return nil
+}
+
+func (s *OrderService) updateStock(ctx context.Context, items []domain.OrderItem, operation product.StockOperation) error {
+	_, err := s.productCli.UpdateStock(ctx, toProductItems(items), operation)
+	return err
+}
+
+func toProductItems(items []domain.OrderItem) []*product.ProductItem {
 	var productItems []*product.ProductItem
 	for _, item := range items {
 		productItems = append(productItems, &product.ProductItem{
@@ -152,25 +546,54 @@ func (s *OrderService) validateProducts(ctx context.Context, items []domain.Orde
 			Quantity:  int32(item.Quantity),
 		})
 	}
+	return productItems
+}
 
-	resp, err := s.productCli.ValidateProducts(ctx, productItems)
-	if err != nil {
-		return ErrProductValidation
-	}
-	if !resp.Valid {
-		return ErrProductValidation
+func calculateTotal(items []domain.OrderItem, currency money.Currency) (money.Money, error) {
+	total := money.Zero(currency)
+	for _, item := range items {
+		var err error
+		total, err = total.Add(item.Price.Mul(int64(item.Quantity)))
+		if err != nil {
+			return money.Money{}, err
+		}
 	}
-	return nil
+	return total, nil
 }
 
-func calculateTotal(items []domain.OrderItem) float64 {
-	total := 0.0
-	for _, item := range items {
-		total += item.Price * float64(item.Quantity)
+func toPaymentMoney(m money.Money) *payment.Money {
+	return &payment.Money{
+		Amount:   m.Amount,
+		Currency: string(m.Currency),
 	}
-	return total
 }
 
 func generateID() string {
 	return uuid.New().String()
 }
+
+func encodePageToken(cursor domain.OrderCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageToken(token string) (*domain.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidPageToken
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	return &domain.OrderCursor{
+		CreatedAt: time.Unix(0, unixNano).UTC(),
+		ID:        id,
+	}, nil
+}
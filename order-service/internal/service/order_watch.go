@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"order-service/internal/domain"
+)
+
+// WatchOrder calls send with the current status of the order and then with
+// every status change until the order reaches a terminal status or ctx is
+// done. Only the user who placed the order may watch it, see GetOrder.
+func (s *OrderService) WatchOrder(ctx context.Context, orderID string, send func(order *domain.Order, change domain.StatusChange) error) error {
+	// Watch before reading the order so that no change slips in between
+	changes, err := s.orderRepo.Watch(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := changes.Close(context.Background()); err != nil {
+			log.Printf("failed to close watch of order %s: %v", orderID, err)
+		}
+	}()
+
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	// Start with the change that led to the current status
+	sent := len(order.StatusHistory)
+	current := domain.StatusChange{To: order.Status, At: order.UpdatedAt}
+	if sent > 0 {
+		current = order.StatusHistory[sent-1]
+	}
+	if err := send(order, current); err != nil {
+		return err
+	}
+
+	for !order.Status.IsTerminal() {
+		order, err = changes.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Saves that do not change the status are not sent
+		for sent < len(order.StatusHistory) {
+			if err := send(order, order.StatusHistory[sent]); err != nil {
+				return err
+			}
+			sent++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"order-service/internal/domain"
+	"shared/signature"
+)
+
+var (
+	ErrInvalidSignature      = errors.New("invalid payment notification signature")
+	ErrUnknownPayment        = errors.New("payment does not belong to the order")
+	ErrPaymentAmountMismatch = errors.New("payment amount does not match the order total")
+)
+
+// HandlePaymentNotification applies the outcome reported by a signed payment
+// notification to the checkout waiting for it: a successful payment resumes
+// the checkout, a failed one compensates it. Notifications are idempotent, a
+// repeated or late notification returns the order as it is.
+func (s *OrderService) HandlePaymentNotification(ctx context.Context, n domain.PaymentNotification) (*domain.Order, error) {
+	if !signature.Verify(s.notificationSecret, n.SignedPayload(), n.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	order, err := s.orderRepo.FindByID(ctx, n.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	saga, err := s.sagaRepo.FindActiveByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if saga == nil || saga.PaymentID != n.PaymentID {
+		if order.PaymentID == n.PaymentID {
+			return order, nil
+		}
+		return nil, ErrUnknownPayment
+	}
+	if saga.Status != domain.SagaStatusAwaitingPayment || n.Status == domain.PaymentStatusPending {
+		return order, nil
+	}
+	if n.Amount != order.Total {
+		return nil, ErrPaymentAmountMismatch
+	}
+
+	// The gRPC callback and the payment event may arrive together
+	claimed, err := s.sagaRepo.Claim(ctx, saga)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return order, nil
+	}
+
+	applyPaymentOutcome(saga, n.Status)
+	if err := s.saveSaga(ctx, saga); err != nil {
+		return nil, err
+	}
+
+	return s.runCheckout(ctx, saga, order)
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"order-service/internal/client"
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+var (
+	ErrPriceMismatch    = errors.New("submitted price does not match the current price")
+	ErrCurrencyMismatch = errors.New("items are not priced in the order currency")
+)
+
+// PriceMismatchPolicy decides what happens when a client submits a unit price
+// that differs from the catalog price. Orders are always charged at the
+// catalog price. Unknown policies reject.
+type PriceMismatchPolicy string
+
+const (
+	PriceMismatchReject PriceMismatchPolicy = "reject"
+	PriceMismatchFlag   PriceMismatchPolicy = "flag"
+)
+
+// priceItems replaces the submitted prices with the catalog prices from
+// product-service and snapshots the product names, tax categories, weights
+// and sellers. All catalog prices must be in the order currency; an empty
+// currency takes the currency of the first item. It reports whether any
+// submitted price differed; with the reject policy that is an error instead.
+func (s *OrderService) priceItems(ctx context.Context, items []domain.OrderItem, currency money.Currency) ([]domain.OrderItem, money.Currency, bool, error) {
+	var productIDs []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	resp, err := s.productCli.GetProductDetails(ctx, productIDs)
+	if err != nil {
+		log.Printf("failed to get product details: %v", err)
+		if client.IsUnavailable(err) {
+			return nil, "", false, ErrProductUnavailable
+		}
+		return nil, "", false, ErrProductValidation
+	}
+
+	details := make(map[string]int, len(resp.Products))
+	for i, p := range resp.Products {
+		details[p.Id] = i
+	}
+
+	mismatch := false
+	priced := make([]domain.OrderItem, 0, len(items))
+	for _, item := range items {
+		i, ok := details[item.ProductID]
+		if !ok || resp.Products[i].Price == nil {
+			return nil, "", false, &ProductError{Err: ErrProductValidation, ProductIDs: []string{item.ProductID}}
+		}
+		p := resp.Products[i]
+
+		price := money.New(p.Price.Amount, money.Currency(p.Price.Currency))
+		if currency == "" {
+			currency = price.Currency
+		}
+		if price.Currency != currency {
+			return nil, "", false, ErrCurrencyMismatch
+		}
+
+		pricedItem := domain.OrderItem{
+			ProductID:   item.ProductID,
+			Name:        p.Name,
+			Quantity:    item.Quantity,
+			Price:       price,
+			TaxCategory: p.TaxCategory,
+			WeightGrams: int(p.WeightGrams),
+			SellerID:    p.SellerId,
+		}
+		// An empty submitted price means the client left pricing to us
+		submitted := item.Price
+		if submitted != (money.Money{}) && submitted != price {
+			if s.priceMismatchPolicy != PriceMismatchFlag {
+				return nil, "", false, ErrPriceMismatch
+			}
+			pricedItem.SubmittedPrice = &submitted
+			mismatch = true
+		}
+		priced = append(priced, pricedItem)
+	}
+
+	return priced, currency, mismatch, nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+var (
+	ErrInvalidCoupon       = errors.New("coupon code is not valid")
+	ErrCouponNotApplicable = errors.New("order does not qualify for the coupon")
+	ErrPromotionUsedUp     = errors.New("promotion usage limit reached")
+	ErrInvalidPromotion    = errors.New("invalid promotion")
+)
+
+// CreatePromotion validates and stores a new promotion. Promotions with a code
+// are coupons, the others apply automatically. A zero start time starts the
+// promotion now.
+func (s *OrderService) CreatePromotion(ctx context.Context, promotion *domain.Promotion) (*domain.Promotion, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	promotion.Code = normalizeCouponCode(promotion.Code)
+	if err := validatePromotion(promotion); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	promotion.ID = generateID()
+	promotion.Uses = 0
+	promotion.Active = true
+	if promotion.StartsAt.IsZero() {
+		promotion.StartsAt = now
+	}
+	promotion.CreatedAt = now
+	promotion.UpdatedAt = now
+
+	if err := s.promotionRepo.Create(ctx, promotion); err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+// applyPromotions discounts the order with every automatic promotion it
+// qualifies for and with the coupon, if any. Discounts stack but never take
+// the total below zero. Each discount is also recorded on the lines it was
+// given on. It returns the promotions to redeem when the order is saved. A
+// coupon that does not apply is an error, an automatic promotion that does
+// not apply is skipped.
+func (s *OrderService) applyPromotions(ctx context.Context, order *domain.Order, couponCode string) ([]domain.Promotion, error) {
+	now := time.Now()
+	promotions, err := s.promotionRepo.FindAutomatic(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if code := normalizeCouponCode(couponCode); code != "" {
+		coupon, err := s.promotionRepo.FindByCode(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		if coupon == nil || !coupon.IsLive(now) {
+			return nil, ErrInvalidCoupon
+		}
+		promotions = append(promotions, *coupon)
+	}
+
+	currency := order.Subtotal.Currency
+	remaining := order.Subtotal
+	discountTotal := money.Zero(currency)
+	for i := range order.Items {
+		order.Items[i].Discount = money.Zero(currency)
+	}
+	var applied []domain.Promotion
+	for _, promotion := range promotions {
+		isCoupon := promotion.Code != ""
+
+		err := s.checkPromotion(ctx, &promotion, order, now)
+		if err != nil && isCoupon {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+
+		amount, weights := promotionDiscount(&promotion, order.Items, currency)
+		if amount.IsZero() {
+			if isCoupon {
+				return nil, ErrCouponNotApplicable
+			}
+			continue
+		}
+		if amount.Amount > remaining.Amount {
+			amount = remaining
+		}
+
+		for i, share := range allocate(amount, weights) {
+			order.Items[i].Discount, _ = order.Items[i].Discount.Add(share)
+		}
+		remaining, _ = remaining.Sub(amount)
+		discountTotal, _ = discountTotal.Add(amount)
+		order.Discounts = append(order.Discounts, domain.AppliedDiscount{
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Name:        promotion.Name,
+			Amount:      amount,
+		})
+		applied = append(applied, promotion)
+	}
+
+	order.DiscountTotal = discountTotal
+	order.Total = remaining
+	return applied, nil
+}
+
+// checkPromotion checks the conditions of a promotion other than the items
+// it discounts.
+func (s *OrderService) checkPromotion(ctx context.Context, promotion *domain.Promotion, order *domain.Order, now time.Time) error {
+	if !promotion.IsLive(now) {
+		return ErrPromotionUsedUp
+	}
+
+	if !promotion.MinSpend.IsZero() {
+		cmp, err := order.Subtotal.Cmp(promotion.MinSpend)
+		if err != nil || cmp < 0 {
+			return ErrCouponNotApplicable
+		}
+	}
+
+	if promotion.PerUserLimit > 0 {
+		uses, err := s.promotionRepo.UserUses(ctx, promotion.ID, order.UserID)
+		if err != nil {
+			return err
+		}
+		if uses >= promotion.PerUserLimit {
+			return ErrPromotionUsedUp
+		}
+	}
+
+	return nil
+}
+
+// promotionDiscount returns the discount the promotion gives on the items and
+// how it is shared by them: by what it gives on each item for buy X get Y,
+// and by the price of the eligible items otherwise.
+func promotionDiscount(promotion *domain.Promotion, items []domain.OrderItem, currency money.Currency) (money.Money, []int64) {
+	eligible := money.Zero(currency)
+	free := money.Zero(currency)
+	eligibleLines := make([]int64, len(items))
+	freeLines := make([]int64, len(items))
+	for i, item := range items {
+		if !promotion.AppliesTo(item.ProductID) || item.Price.Currency != currency {
+			continue
+		}
+		line := item.Price.Mul(int64(item.Quantity))
+		eligible, _ = eligible.Add(line)
+		eligibleLines[i] = line.Amount
+
+		if promotion.Type == domain.PromotionBuyXGetY {
+			groups := item.Quantity / (promotion.BuyQuantity + promotion.GetQuantity)
+			line := item.Price.Mul(int64(groups * promotion.GetQuantity))
+			free, _ = free.Add(line)
+			freeLines[i] = line.Amount
+		}
+	}
+
+	switch promotion.Type {
+	case domain.PromotionPercentage:
+		return eligible.MulRatio(promotion.PercentOff, 100), eligibleLines
+	case domain.PromotionFixed:
+		if promotion.AmountOff.Currency != currency {
+			return money.Zero(currency), nil
+		}
+		if promotion.AmountOff.Amount > eligible.Amount {
+			return eligible, eligibleLines
+		}
+		return promotion.AmountOff, eligibleLines
+	case domain.PromotionBuyXGetY:
+		return free, freeLines
+	}
+	return money.Zero(currency), nil
+}
+
+// allocate splits amount in proportion to the weights. The last share with a
+// weight takes what rounding left.
+func allocate(amount money.Money, weights []int64) []money.Money {
+	var total int64
+	last := -1
+	for i, weight := range weights {
+		if weight > 0 {
+			total += weight
+			last = i
+		}
+	}
+
+	shares := make([]money.Money, len(weights))
+	left := amount
+	for i, weight := range weights {
+		shares[i] = money.Zero(amount.Currency)
+		switch {
+		case weight <= 0:
+		case i == last:
+			shares[i] = left
+		default:
+			shares[i] = amount.MulRatio(weight, total)
+			left.Amount -= shares[i].Amount
+		}
+	}
+	return shares
+}
+
+func validatePromotion(p *domain.Promotion) error {
+	if p.Name == "" || p.PerUserLimit < 0 || p.TotalLimit < 0 {
+		return ErrInvalidPromotion
+	}
+	if !p.EndsAt.IsZero() && !p.EndsAt.After(p.StartsAt) {
+		return ErrInvalidPromotion
+	}
+	if !p.MinSpend.IsZero() && (p.MinSpend.IsNegative() || p.MinSpend.Validate() != nil) {
+		return ErrInvalidPromotion
+	}
+
+	switch p.Type {
+	case domain.PromotionPercentage:
+		if p.PercentOff <= 0 || p.PercentOff > 100 {
+			return ErrInvalidPromotion
+		}
+	case domain.PromotionFixed:
+		if p.AmountOff.IsZero() || p.AmountOff.IsNegative() || p.AmountOff.Validate() != nil {
+			return ErrInvalidPromotion
+		}
+	case domain.PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return ErrInvalidPromotion
+		}
+	default:
+		return ErrInvalidPromotion
+	}
+	return nil
+}
+
+// normalizeCouponCode makes coupon codes case insensitive.
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"order-service/gen/payment"
+	"order-service/gen/product"
+	"order-service/internal/client"
+	"order-service/internal/domain"
+	"shared/money"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRefund = errors.New("invalid refund")
+
+// RefundOrder pays back the given quantities of the items of a paid order, or
+// everything not refunded yet when items is empty. Items refunded before the
+// order shipped go back into stock. The order moves to refunded once all of
+// its items are refunded.
+//
+// The refund is recorded pending on the order under a new ID before the
+// payment service pays it back with that ID as its idempotency key, so
+// concurrent refunds never share a key and a refund is paid once however
+// often it is retried. Refunds left pending by an earlier request are paid
+// first.
+func (s *OrderService) RefundOrder(ctx context.Context, orderID, actor, reason string, items []domain.RefundItem) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if actor == "" {
+		actor = domain.ActorSystem
+	}
+
+	order, err := s.orderRepo.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if err := s.payPendingRefunds(ctx, order); err != nil {
+		return nil, err
+	}
+
+	// Start over from the stored order when another update wins the race
+	refundID := uuid.New().String()
+	err = s.updateOrder(ctx, order, func(order *domain.Order) error {
+		if !order.Status.CanTransitionTo(domain.OrderStatusRefunded) {
+			return domain.ErrInvalidStatusTransition
+		}
+		refundItems := items
+		if len(refundItems) == 0 {
+			refundItems = unrefundedItems(order)
+		}
+		return recordRefund(order, refundID, refundItems, actor, reason, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.payRefund(ctx, order, refundID); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// payPendingRefunds pays the refunds of the order left pending by earlier
+// requests. The order ends up as saved.
+func (s *OrderService) payPendingRefunds(ctx context.Context, order *domain.Order) error {
+	for _, refundID := range order.PendingRefunds() {
+		if err := s.payRefund(ctx, order, refundID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// payRefund pays back a refund recorded pending on the order and saves the
+// outcome. A paid refund completes, refunding or cancelling the order when
+// it asked for it; a refund the payment service rejected is rolled back. A
+// refund the payment service could not answer for stays pending. The order
+// ends up as saved.
+func (s *OrderService) payRefund(ctx context.Context, order *domain.Order, refundID string) error {
+	refund := order.Refund(refundID)
+	if refund == nil || !refund.IsPending() {
+		return nil
+	}
+
+	resp, err := s.paymentCli.ProcessRefund(ctx, &payment.RefundRequest{
+		PaymentId:      order.PaymentID,
+		OrderId:        order.ID,
+		Amount:         toPaymentMoney(refund.Amount),
+		Reason:         refund.Reason,
+		IdempotencyKey: refund.ID,
+	})
+	switch {
+	case err == nil && resp.Status == domain.PaymentStatusSuccess:
+	case err == nil && resp.Status == domain.PaymentStatusFailed, client.IsRejected(err):
+		log.Printf("payment service rejected refund %s of order %s: %v", refundID, order.ID, err)
+		if err := s.updateOrder(ctx, order, func(order *domain.Order) error {
+			rollbackRefund(order, refundID)
+			return nil
+		}); err != nil {
+			log.Printf("failed to roll back refund %s of order %s: %v", refundID, order.ID, err)
+		}
+		return ErrRefundProcessing
+	default:
+		if err != nil {
+			log.Printf("failed to pay refund %s of order %s: %v", refundID, order.ID, err)
+		}
+		return ErrRefundProcessing
+	}
+
+	// Start over from the stored order when another update wins the race
+	var restock []domain.RefundItem
+	first := true
+	err = retryOnConflict(ctx, func() error {
+		if !first {
+			if err := s.reloadOrder(ctx, order); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		restock = nil
+		refund := order.Refund(refundID)
+		if refund == nil || !refund.IsPending() {
+			return nil
+		}
+		// Items that never left the warehouse can be sold again
+		if order.Status == domain.OrderStatusPaid {
+			restock = refund.Items
+		}
+
+		topic, event, err := completeRefund(order, refund, resp.RefundId)
+		if err != nil {
+			return err
+		}
+		return s.saveWithEvent(ctx, func(ctx context.Context) error {
+			return s.orderRepo.Update(ctx, order)
+		}, topic, order.ID, event)
+	})
+	if err != nil {
+		log.Printf("failed to save refund %s of order %s: %v", refundID, order.ID, err)
+		return err
+	}
+
+	if len(restock) > 0 {
+		if err := s.updateStock(ctx, refundedOrderItems(restock), product.StockOperation_STOCK_OPERATION_INCREASE); err != nil {
+			log.Printf("failed to restock refunded items of order %s: %v", order.ID, err)
+		}
+	}
+	return nil
+}
+
+// recordRefund marks the refunded quantities on the order items and records
+// the refund pending under refundID. A cancellation refund cancels the order
+// once it is paid.
+func recordRefund(order *domain.Order, refundID string, items []domain.RefundItem, actor, reason string, cancellation bool) error {
+	amount, shares, err := applyRefund(order, items)
+	if err != nil {
+		return err
+	}
+
+	order.Refunds = append(order.Refunds, domain.Refund{
+		ID:           refundID,
+		Items:        items,
+		Amount:       amount,
+		Actor:        actor,
+		Reason:       reason,
+		Status:       domain.RefundStatusPending,
+		Cancellation: cancellation,
+		Shares:       shares,
+		CreatedAt:    time.Now(),
+	})
+	return nil
+}
+
+// completeRefund records a pending refund as paid. The order is cancelled
+// by a cancellation refund and refunded once all of its items are refunded
+// and no other refund is pending. It returns the event to save with the
+// order.
+func completeRefund(order *domain.Order, refund *domain.Refund, paymentRefundID string) (string, interface{}, error) {
+	refundedTotal, err := order.RefundedTotal.Add(refund.Amount)
+	if err != nil {
+		return "", nil, err
+	}
+	refund.Status = domain.RefundStatusPaid
+	refund.PaymentRefundID = paymentRefundID
+	order.RefundedTotal = refundedTotal
+	for _, share := range refund.Shares {
+		if sub := order.SubOrder(share.SubOrderID); sub != nil {
+			if err := sub.ApplyRefund(share.Amount); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	if refund.Cancellation {
+		if err := order.TransitionTo(domain.OrderStatusCancelled, refund.Actor, refund.Reason); err != nil {
+			return "", nil, err
+		}
+		return "order.cancelled", domain.OrderCancelledEvent{
+			OrderID:     order.ID,
+			UserID:      order.UserID,
+			Items:       order.Items,
+			Refunded:    true,
+			Reason:      refund.Reason,
+			CancelledAt: order.UpdatedAt,
+		}, nil
+	}
+
+	fullRefund := len(unrefundedItems(order)) == 0 && len(order.PendingRefunds()) == 0
+	if fullRefund && order.Status.CanTransitionTo(domain.OrderStatusRefunded) {
+		if err := order.TransitionTo(domain.OrderStatusRefunded, refund.Actor, refund.Reason); err != nil {
+			return "", nil, err
+		}
+	} else {
+		order.UpdatedAt = time.Now()
+	}
+	return "order.refunded", domain.OrderRefundedEvent{
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		RefundID:   refund.ID,
+		Items:      refund.Items,
+		Amount:     refund.Amount,
+		FullRefund: fullRefund,
+		Reason:     refund.Reason,
+		RefundedAt: order.UpdatedAt,
+	}, nil
+}
+
+// rollbackRefund removes a pending refund the payment service rejected and
+// gives its quantities back to the order items. applyRefund takes quantities
+// from the first matching items, so they are given back from the last.
+func rollbackRefund(order *domain.Order, refundID string) {
+	for i, refund := range order.Refunds {
+		if refund.ID != refundID || !refund.IsPending() {
+			continue
+		}
+		for _, item := range refund.Items {
+			left := item.Quantity
+			for j := len(order.Items) - 1; j >= 0 && left > 0; j-- {
+				if order.Items[j].ProductID != item.ProductID {
+					continue
+				}
+				n := min(left, order.Items[j].RefundedQuantity)
+				order.Items[j].RefundedQuantity -= n
+				left -= n
+			}
+		}
+		order.Refunds = append(order.Refunds[:i], order.Refunds[i+1:]...)
+		return
+	}
+}
+
+// applyRefund marks the refunded quantities on the order items and returns
+// the amount to pay back, split between the sub-orders of the items. The
+// order is left untouched when the refund asks for more than is left to
+// refund.
+func applyRefund(order *domain.Order, items []domain.RefundItem) (money.Money, []domain.RefundShare, error) {
+	orderItems := make([]domain.OrderItem, len(order.Items))
+	copy(orderItems, order.Items)
+
+	amount := money.Zero(order.Total.Currency)
+	tax := money.Zero(order.Total.Currency)
+	var sellers []string
+	sellerAmounts := make(map[string]int64)
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return money.Money{}, nil, ErrInvalidRefund
+		}
+
+		left := item.Quantity
+		for i := range orderItems {
+			if orderItems[i].ProductID != item.ProductID || left == 0 {
+				continue
+			}
+			n := min(left, orderItems[i].Quantity-orderItems[i].RefundedQuantity)
+			orderItems[i].RefundedQuantity += n
+			left -= n
+
+			if n == 0 {
+				continue
+			}
+			// Items are paid back less the discounts given on them
+			lineAmount := orderItems[i].Price.Mul(int64(n))
+			if discount := orderItems[i].Discount; discount.Amount > 0 {
+				lineAmount.Amount -= discount.MulRatio(int64(n), int64(orderItems[i].Quantity)).Amount
+			}
+			var err error
+			amount, err = amount.Add(lineAmount)
+			if err != nil {
+				return money.Money{}, nil, err
+			}
+			if order.TaxMode == domain.TaxExclusive {
+				lineTax := orderItems[i].Tax.MulRatio(int64(n), int64(orderItems[i].Quantity))
+				tax, err = tax.Add(lineTax)
+				if err != nil {
+					return money.Money{}, nil, err
+				}
+				lineAmount.Amount += lineTax.Amount
+			}
+
+			sellerID := orderItems[i].SellerID
+			if _, ok := sellerAmounts[sellerID]; !ok {
+				sellers = append(sellers, sellerID)
+			}
+			sellerAmounts[sellerID] += lineAmount.Amount
+		}
+		if left > 0 {
+			return money.Money{}, nil, ErrInvalidRefund
+		}
+	}
+	if amount.IsZero() {
+		return money.Money{}, nil, ErrInvalidRefund
+	}
+
+	// Exclusive tax is paid back with the items it was charged on
+	amount, err := amount.Add(tax)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+
+	// The last refund pays back whatever is left of the total, counting the
+	// refunds still being paid
+	remaining, err := order.Total.Sub(order.RefundedTotal)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+	for _, refund := range order.Refunds {
+		if refund.IsPending() {
+			remaining, err = remaining.Sub(refund.Amount)
+			if err != nil {
+				return money.Money{}, nil, err
+			}
+		}
+	}
+	fullyRefunded := true
+	for _, item := range orderItems {
+		if item.RefundedQuantity < item.Quantity {
+			fullyRefunded = false
+		}
+	}
+	if cmp, _ := amount.Cmp(remaining); fullyRefunded || cmp > 0 {
+		amount = remaining
+	}
+
+	order.Items = orderItems
+	return amount, refundShares(order, sellers, sellerAmounts, amount), nil
+}
+
+// refundShares splits a refund between the sub-orders of the sellers of the
+// refunded items, in proportion to what their items cost. The last seller
+// takes what rounding left.
+func refundShares(order *domain.Order, sellers []string, sellerAmounts map[string]int64, amount money.Money) []domain.RefundShare {
+	if len(order.SubOrders) == 0 {
+		return nil
+	}
+
+	var gross int64
+	for _, sellerID := range sellers {
+		gross += sellerAmounts[sellerID]
+	}
+
+	var shares []domain.RefundShare
+	left := amount
+	for i, sellerID := range sellers {
+		share := left
+		if i < len(sellers)-1 && gross > 0 {
+			share = amount.MulRatio(sellerAmounts[sellerID], gross)
+		}
+		left.Amount -= share.Amount
+
+		for _, sub := range order.SubOrders {
+			if sub.SellerID == sellerID {
+				shares = append(shares, domain.RefundShare{
+					SubOrderID: sub.ID,
+					Amount:     share,
+				})
+				break
+			}
+		}
+	}
+	return shares
+}
+
+// unrefundedItems returns the quantities of the order items not refunded yet.
+func unrefundedItems(order *domain.Order) []domain.RefundItem {
+	var items []domain.RefundItem
+	for _, item := range order.Items {
+		if left := item.Quantity - item.RefundedQuantity; left > 0 {
+			items = append(items, domain.RefundItem{
+				ProductID: item.ProductID,
+				Quantity:  left,
+			})
+		}
+	}
+	return items
+}
+
+func refundedOrderItems(items []domain.RefundItem) []domain.OrderItem {
+	orderItems := make([]domain.OrderItem, 0, len(items))
+	for _, item := range items {
+		orderItems = append(orderItems, domain.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+	return orderItems
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+func usd(amount int64) money.Money {
+	return money.New(amount, money.USD)
+}
+
+func TestApplyRefund(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      domain.Order
+		items      []domain.RefundItem
+		wantAmount money.Money
+		wantShares []domain.RefundShare
+		wantErr    error
+	}{
+		{
+			name: "one of two units",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 2, Price: usd(1000), Discount: usd(0)}},
+				Total:         usd(2000),
+				RefundedTotal: usd(0),
+			},
+			items:      []domain.RefundItem{{ProductID: "a", Quantity: 1}},
+			wantAmount: usd(1000),
+		},
+		{
+			name: "less the discount given on the line",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 2, Price: usd(1000), Discount: usd(200)}},
+				Total:         usd(1800),
+				RefundedTotal: usd(0),
+			},
+			items:      []domain.RefundItem{{ProductID: "a", Quantity: 1}},
+			wantAmount: usd(900),
+		},
+		{
+			name: "exclusive tax paid back with its items",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 2, Price: usd(1000), Discount: usd(0), Tax: usd(220)}},
+				TaxMode:       domain.TaxExclusive,
+				Total:         usd(2220),
+				RefundedTotal: usd(0),
+			},
+			items:      []domain.RefundItem{{ProductID: "a", Quantity: 1}},
+			wantAmount: usd(1110),
+		},
+		{
+			name: "last unit takes what rounding left",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 3, RefundedQuantity: 2, Price: usd(100), Discount: usd(100)}},
+				Total:         usd(200),
+				RefundedTotal: usd(134),
+			},
+			items:      []domain.RefundItem{{ProductID: "a", Quantity: 1}},
+			wantAmount: usd(66),
+		},
+		{
+			name: "pending refunds count as paid back",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 2, RefundedQuantity: 1, Price: usd(1000), Discount: usd(1)}},
+				Total:         usd(1999),
+				RefundedTotal: usd(0),
+				Refunds:       []domain.Refund{{Amount: usd(1000), Status: domain.RefundStatusPending}},
+			},
+			items:      []domain.RefundItem{{ProductID: "a", Quantity: 1}},
+			wantAmount: usd(999),
+		},
+		{
+			name: "split between the sellers of the items",
+			order: domain.Order{
+				Items: []domain.OrderItem{
+					{ProductID: "a", Quantity: 1, Price: usd(1000), Discount: usd(0), SellerID: "s1"},
+					{ProductID: "b", Quantity: 1, Price: usd(500), Discount: usd(0), SellerID: "s2"},
+				},
+				Total:         usd(1500),
+				RefundedTotal: usd(0),
+				SubOrders:     []domain.SubOrder{{ID: "sub1", SellerID: "s1"}, {ID: "sub2", SellerID: "s2"}},
+			},
+			items:      []domain.RefundItem{{ProductID: "a", Quantity: 1}, {ProductID: "b", Quantity: 1}},
+			wantAmount: usd(1500),
+			wantShares: []domain.RefundShare{{SubOrderID: "sub1", Amount: usd(1000)}, {SubOrderID: "sub2", Amount: usd(500)}},
+		},
+		{
+			name: "more than is left",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 1, RefundedQuantity: 1, Price: usd(1000)}},
+				Total:         usd(1000),
+				RefundedTotal: usd(0),
+			},
+			items:   []domain.RefundItem{{ProductID: "a", Quantity: 1}},
+			wantErr: ErrInvalidRefund,
+		},
+		{
+			name: "zero quantity",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 1, Price: usd(1000)}},
+				Total:         usd(1000),
+				RefundedTotal: usd(0),
+			},
+			items:   []domain.RefundItem{{ProductID: "a", Quantity: 0}},
+			wantErr: ErrInvalidRefund,
+		},
+		{
+			name: "product not in the order",
+			order: domain.Order{
+				Items:         []domain.OrderItem{{ProductID: "a", Quantity: 1, Price: usd(1000)}},
+				Total:         usd(1000),
+				RefundedTotal: usd(0),
+			},
+			items:   []domain.RefundItem{{ProductID: "b", Quantity: 1}},
+			wantErr: ErrInvalidRefund,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.order
+			before := append([]domain.OrderItem(nil), order.Items...)
+
+			amount, shares, err := applyRefund(&order, tt.items)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyRefund() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				for i := range before {
+					if order.Items[i].RefundedQuantity != before[i].RefundedQuantity {
+						t.Errorf("Items[%d].RefundedQuantity changed on error", i)
+					}
+				}
+				return
+			}
+			if amount != tt.wantAmount {
+				t.Errorf("amount = %v, want %v", amount, tt.wantAmount)
+			}
+			if len(shares) != len(tt.wantShares) {
+				t.Fatalf("shares = %v, want %v", shares, tt.wantShares)
+			}
+			for i := range shares {
+				if shares[i] != tt.wantShares[i] {
+					t.Errorf("shares[%d] = %v, want %v", i, shares[i], tt.wantShares[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+var (
+	ErrInvalidAddress      = errors.New("invalid address")
+	ErrShippingUnavailable = errors.New("shipping method not available for the destination")
+	ErrInvalidShippingRate = errors.New("invalid shipping rate")
+)
+
+// defaultShippingMethod is used when a shipped order does not pick a method.
+const defaultShippingMethod = "standard"
+
+// ShippingCalculator quotes the cost of shipping an order of the given weight
+// and amount, after discounts, to a destination. It returns
+// ErrShippingUnavailable when the method does not ship there.
+type ShippingCalculator interface {
+	Quote(ctx context.Context, method string, destination domain.Destination, weightGrams int, amount money.Money) (money.Money, error)
+}
+
+// RateTable is a ShippingCalculator over fixed rates per method and zone.
+type RateTable struct {
+	rates []domain.ShippingRate
+}
+
+// NewRateTable parses rates written as
+// METHOD:ZONE:CURRENCY:BASE:PER_KG:FREE_OVER with amounts in minor units, e.g.
+// "standard:ID:IDR:15000:5000:500000". A zone of "*" ships everywhere, a zero
+// PER_KG is a flat rate and a zero FREE_OVER never ships for free.
+func NewRateTable(entries []string) (*RateTable, error) {
+	table := &RateTable{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) != 6 || fields[0] == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidShippingRate, entry)
+		}
+		currency, err := money.ParseCurrency(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidShippingRate, entry, err)
+		}
+		var amounts [3]money.Money
+		for i, field := range fields[3:] {
+			amount, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || amount < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidShippingRate, entry)
+			}
+			amounts[i] = money.New(amount, currency)
+		}
+
+		zone := strings.ToUpper(fields[1])
+		if zone == "*" {
+			zone = ""
+		}
+		table.rates = append(table.rates, domain.ShippingRate{
+			Method:   fields[0],
+			Zone:     zone,
+			Base:     amounts[0],
+			PerKg:    amounts[1],
+			FreeOver: amounts[2],
+		})
+	}
+	return table, nil
+}
+
+// Quote uses the most specific rate of the method for the destination and the
+// order currency: a region rate beats a country rate, which beats the rate for
+// everywhere. Weight is charged per started kilogram.
+func (t *RateTable) Quote(ctx context.Context, method string, destination domain.Destination, weightGrams int, amount money.Money) (money.Money, error) {
+	country := strings.ToUpper(destination.Country)
+	region := country + "-" + strings.ToUpper(destination.Region)
+
+	var best *domain.ShippingRate
+	bestScore := -1
+	for i, r := range t.rates {
+		if r.Method != method || r.Base.Currency != amount.Currency {
+			continue
+		}
+		score := -1
+		switch {
+		case r.Zone == "":
+			score = 0
+		case r.Zone == country:
+			score = 1
+		case destination.Region != "" && r.Zone == region:
+			score = 2
+		}
+		if score > bestScore {
+			best, bestScore = &t.rates[i], score
+		}
+	}
+	if best == nil {
+		return money.Money{}, ErrShippingUnavailable
+	}
+
+	if !best.FreeOver.IsZero() {
+		if cmp, err := amount.Cmp(best.FreeOver); err == nil && cmp >= 0 {
+			return money.Zero(amount.Currency), nil
+		}
+	}
+	kilograms := (weightGrams + 999) / 1000
+	return best.Base.Add(best.PerKg.Mul(int64(kilograms)))
+}
+
+// applyDelivery validates the addresses and sets them, the shipping method and
+// the tax destination on the order. Billing defaults to the shipping address.
+func applyDelivery(order *domain.Order, delivery domain.Delivery) error {
+	order.ShippingCost = money.Zero(order.Subtotal.Currency)
+
+	if delivery.ShippingAddress == nil {
+		if delivery.BillingAddress != nil && !delivery.BillingAddress.IsComplete() {
+			return ErrInvalidAddress
+		}
+		if delivery.Destination != nil && delivery.Destination.Country == "" {
+			return ErrInvalidAddress
+		}
+		order.BillingAddress = delivery.BillingAddress
+		order.Destination = delivery.Destination
+		return nil
+	}
+
+	if !delivery.ShippingAddress.IsComplete() {
+		return ErrInvalidAddress
+	}
+	billing := delivery.BillingAddress
+	if billing == nil {
+		billing = delivery.ShippingAddress
+	}
+	if !billing.IsComplete() {
+		return ErrInvalidAddress
+	}
+	method := delivery.ShippingMethod
+	if method == "" {
+		method = defaultShippingMethod
+	}
+
+	order.ShippingAddress = delivery.ShippingAddress
+	order.BillingAddress = billing
+	order.ShippingMethod = method
+	order.Destination = delivery.ShippingAddress.Destination()
+	return nil
+}
+
+// applyShipping quotes the shipping of a shipped order and adds it to the
+// total. Every seller ships its own parcel, so each sub-order is quoted for
+// the weight and amount of its items. It runs after the discounts so that
+// free shipping thresholds apply to what the customer pays for the items.
+func (s *OrderService) applyShipping(ctx context.Context, order *domain.Order) error {
+	if order.ShippingAddress == nil {
+		return nil
+	}
+
+	for i := range order.SubOrders {
+		sub := &order.SubOrders[i]
+
+		weight := 0
+		for _, item := range order.Items {
+			if item.SellerID == sub.SellerID {
+				weight += item.WeightGrams * item.Quantity
+			}
+		}
+		amount, err := sub.Subtotal.Sub(sub.DiscountTotal)
+		if err != nil {
+			return err
+		}
+
+		cost, err := s.shipping.Quote(ctx, order.ShippingMethod, *order.Destination, weight, amount)
+		if err != nil {
+			return err
+		}
+		if err := addShipping(sub, order, cost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addShipping charges cost to the sub-order and the order. The seller ships
+// the parcel and is paid out its shipping.
+func addShipping(sub *domain.SubOrder, order *domain.Order, cost money.Money) error {
+	amounts := []*money.Money{&sub.ShippingCost, &sub.Total, &sub.Payout, &order.ShippingCost, &order.Total}
+	for _, amount := range amounts {
+		sum, err := amount.Add(cost)
+		if err != nil {
+			return err
+		}
+		*amount = sum
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+// splitOrder creates a sub-order per seller, in the order the sellers' items
+// first appear. Sub-orders take the subtotal, discounts and tax of their
+// items. Sellers pay a commission of commissionRate basis points on their
+// discounted subtotal; the shop's own items pay none. Shipping is added by
+// applyShipping.
+func (s *OrderService) splitOrder(order *domain.Order) error {
+	currency := order.Subtotal.Currency
+
+	var sellers []string
+	subtotals := make(map[string]money.Money)
+	discounts := make(map[string]money.Money)
+	taxes := make(map[string]money.Money)
+	for _, item := range order.Items {
+		if _, ok := subtotals[item.SellerID]; !ok {
+			sellers = append(sellers, item.SellerID)
+			subtotals[item.SellerID] = money.Zero(currency)
+			discounts[item.SellerID] = money.Zero(currency)
+			taxes[item.SellerID] = money.Zero(currency)
+		}
+
+		var err error
+		subtotals[item.SellerID], err = subtotals[item.SellerID].Add(item.Price.Mul(int64(item.Quantity)))
+		if err != nil {
+			return err
+		}
+		if !item.Discount.IsZero() {
+			discounts[item.SellerID], err = discounts[item.SellerID].Add(item.Discount)
+			if err != nil {
+				return err
+			}
+		}
+		if !item.Tax.IsZero() {
+			taxes[item.SellerID], err = taxes[item.SellerID].Add(item.Tax)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	subOrders := make([]domain.SubOrder, 0, len(sellers))
+	for i, sellerID := range sellers {
+		subtotal := subtotals[sellerID]
+		discount := discounts[sellerID]
+		net, err := subtotal.Sub(discount)
+		if err != nil {
+			return err
+		}
+		total := net
+		if order.TaxMode == domain.TaxExclusive {
+			total, err = total.Add(taxes[sellerID])
+			if err != nil {
+				return err
+			}
+		}
+		commission := money.Zero(currency)
+		if sellerID != "" {
+			commission = net.MulRatio(s.commissionRate, basisPoints)
+		}
+		payout, err := total.Sub(commission)
+		if err != nil {
+			return err
+		}
+
+		subOrders = append(subOrders, domain.SubOrder{
+			ID:            fmt.Sprintf("%s-%d", order.ID, i+1),
+			SellerID:      sellerID,
+			Subtotal:      subtotal,
+			DiscountTotal: discount,
+			TaxTotal:      taxes[sellerID],
+			ShippingCost:  money.Zero(currency),
+			Total:         total,
+			Commission:    commission,
+			Payout:        payout,
+			Status:        order.Status,
+			StatusHistory: []domain.StatusChange{{
+				To:     order.Status,
+				Actor:  order.UserID,
+				Reason: "order created",
+				At:     order.CreatedAt,
+			}},
+			UpdatedAt: order.CreatedAt,
+		})
+	}
+
+	order.SubOrders = subOrders
+	return nil
+}
+
+// UpdateSubOrderStatus lets a seller ship and deliver its sub-order of a paid
+// order. The order is shipped once every seller shipped and delivered once
+// every sub-order is delivered.
+func (s *OrderService) UpdateSubOrderStatus(ctx context.Context, orderID, subOrderID string, status domain.OrderStatus, actor, reason string) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if status != domain.OrderStatusShipped && status != domain.OrderStatusDelivered {
+		return nil, domain.ErrInvalidStatusTransition
+	}
+	if actor == "" {
+		actor = domain.ActorSystem
+	}
+
+	// Start over from the stored order when another update wins the race
+	var order *domain.Order
+	err := retryOnConflict(ctx, func() error {
+		var err error
+		order, err = s.updateSubOrderStatus(ctx, orderID, subOrderID, status, actor, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *OrderService) updateSubOrderStatus(ctx context.Context, orderID, subOrderID string, status domain.OrderStatus, actor, reason string) (*domain.Order, error) {
+	order, err := s.orderRepo.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	sub := order.SubOrder(subOrderID)
+	if sub == nil {
+		return nil, domain.ErrSubOrderNotFound
+	}
+	if err := authorizeSubOrder(ctx, sub); err != nil {
+		return nil, err
+	}
+	sellerID := sub.SellerID
+
+	if err := order.TransitionSubOrder(subOrderID, status, actor, reason); err != nil {
+		return nil, err
+	}
+
+	// Save the order together with its SubOrderStatusChanged event
+	err = s.saveWithEvent(ctx, func(ctx context.Context) error {
+		return s.orderRepo.Update(ctx, order)
+	}, "order.sub_order_status_changed", order.ID, domain.SubOrderStatusChangedEvent{
+		OrderID:    order.ID,
+		SubOrderID: subOrderID,
+		SellerID:   sellerID,
+		UserID:     order.UserID,
+		Status:     status,
+		Reason:     reason,
+		ChangedAt:  order.UpdatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
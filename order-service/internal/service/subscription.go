@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"order-service/internal/domain"
+	"order-service/internal/repository"
+	"shared/auth"
+	"shared/money"
+)
+
+var (
+	ErrInvalidSubscription      = errors.New("invalid subscription")
+	ErrSubscriptionNotFound     = errors.New("subscription not found")
+	ErrSubscriptionStateInvalid = errors.New("subscription cannot do this in its current status")
+)
+
+const (
+	subscriptionBatch = 100
+	// maxSubscriptionRetryDelay caps the doubling of the retry delay
+	maxSubscriptionRetryDelay = 30 * 24 * time.Hour
+
+	subscriptionFailedReason  = "payment failed"
+	subscriptionCancelReason  = "subscription cancelled"
+	subscriptionDunningReason = "subscription payment failed"
+)
+
+// DunningPolicy decides how failed subscription payments are retried. The
+// n-th retry waits RetryDelay doubled n-1 times, at most 30 days; after
+// MaxAttempts failed payments the order is cancelled and the subscription
+// paused.
+type DunningPolicy struct {
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// Validate rejects policies that would never charge a payment or retry it.
+func (p DunningPolicy) Validate() error {
+	if p.MaxAttempts <= 0 {
+		return fmt.Errorf("max attempts must be positive, got %d", p.MaxAttempts)
+	}
+	if p.RetryDelay <= 0 {
+		return fmt.Errorf("retry delay must be positive, got %s", p.RetryDelay)
+	}
+	return nil
+}
+
+// retryDelay returns how long the retry after attempts failed payments waits.
+func (p DunningPolicy) retryDelay(attempts int) time.Duration {
+	delay := p.RetryDelay
+	for i := 1; i < attempts && delay < maxSubscriptionRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, max(maxSubscriptionRetryDelay, p.RetryDelay))
+}
+
+// CreateSubscription subscribes the user to the items on a schedule. The
+// orders are placed like CreateOrder and charged to the saved payment method.
+// The first order is placed at firstRunAt, or right away when it is zero.
+func (s *OrderService) CreateSubscription(ctx context.Context, userID string, items []domain.SubscriptionItem, schedule domain.Schedule, currency money.Currency, delivery domain.Delivery, paymentMethod string, firstRunAt time.Time) (*domain.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if userID == "" || len(items) == 0 || paymentMethod == "" {
+		return nil, ErrInvalidSubscription
+	}
+	for _, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return nil, ErrInvalidSubscription
+		}
+	}
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	if err := applyDelivery(&domain.Order{}, delivery); err != nil {
+		return nil, err
+	}
+
+	// The products must be sold in one currency, which the orders keep
+	_, currency, _, err := s.priceItems(ctx, subscriptionOrderItems(items), currency)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if firstRunAt.IsZero() || firstRunAt.Before(now) {
+		firstRunAt = now
+	}
+	subscription := &domain.Subscription{
+		ID:              generateID(),
+		UserID:          userID,
+		Items:           items,
+		Currency:        currency,
+		Schedule:        schedule,
+		NextRunAt:       firstRunAt,
+		ShippingAddress: delivery.ShippingAddress,
+		BillingAddress:  delivery.BillingAddress,
+		ShippingMethod:  delivery.ShippingMethod,
+		PaymentMethod:   paymentMethod,
+		Status:          domain.SubscriptionStatusActive,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// GetSubscription returns a subscription. Users may only read their own
+// subscriptions.
+func (s *OrderService) GetSubscription(ctx context.Context, id string) (*domain.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.loadSubscription(ctx, id)
+}
+
+// ListSubscriptions returns the user's subscriptions, newest first.
+func (s *OrderService) ListSubscriptions(ctx context.Context, userID string) ([]domain.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if userID == "" {
+		return nil, ErrInvalidSubscription
+	}
+	return s.subscriptionRepo.FindByUser(ctx, userID)
+}
+
+// PauseSubscription stops placing orders until the subscription is resumed.
+func (s *OrderService) PauseSubscription(ctx context.Context, id string) (*domain.Subscription, error) {
+	return s.updateSubscription(ctx, id, func(subscription *domain.Subscription) error {
+		if subscription.Status != domain.SubscriptionStatusActive {
+			return ErrSubscriptionStateInvalid
+		}
+		subscription.Status = domain.SubscriptionStatusPaused
+		return nil
+	})
+}
+
+// ResumeSubscription starts placing orders again, optionally charging them to
+// a new payment method, e.g. after payments kept failing. Runs missed while
+// paused are skipped.
+func (s *OrderService) ResumeSubscription(ctx context.Context, id, paymentMethod string) (*domain.Subscription, error) {
+	return s.updateSubscription(ctx, id, func(subscription *domain.Subscription) error {
+		if subscription.Status != domain.SubscriptionStatusPaused {
+			return ErrSubscriptionStateInvalid
+		}
+		subscription.Status = domain.SubscriptionStatusActive
+		subscription.PauseReason = ""
+		if paymentMethod != "" {
+			subscription.PaymentMethod = paymentMethod
+		}
+		if subscription.PendingOrderID == "" {
+			subscription.SkipTo(time.Now())
+		}
+		return nil
+	})
+}
+
+// SkipSubscription skips the next scheduled order.
+func (s *OrderService) SkipSubscription(ctx context.Context, id string) (*domain.Subscription, error) {
+	return s.updateSubscription(ctx, id, func(subscription *domain.Subscription) error {
+		if subscription.Status == domain.SubscriptionStatusCancelled {
+			return ErrSubscriptionStateInvalid
+		}
+		subscription.NextRunAt = subscription.Schedule.Next(subscription.NextRunAt)
+		return nil
+	})
+}
+
+// CancelSubscription ends the subscription. An order of the current run that
+// is not paid yet is cancelled with it.
+func (s *OrderService) CancelSubscription(ctx context.Context, id string) (*domain.Subscription, error) {
+	var pendingOrderID string
+	subscription, err := s.updateSubscription(ctx, id, func(subscription *domain.Subscription) error {
+		if subscription.Status == domain.SubscriptionStatusCancelled {
+			return ErrSubscriptionStateInvalid
+		}
+		pendingOrderID = subscription.PendingOrderID
+		subscription.Status = domain.SubscriptionStatusCancelled
+		subscription.PendingOrderID = ""
+		subscription.RetryAt = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if pendingOrderID != "" {
+		s.cancelSubscriptionOrder(ctx, pendingOrderID, subscriptionCancelReason)
+	}
+	return subscription, nil
+}
+
+// loadSubscription returns the stored subscription if the caller owns it.
+func (s *OrderService) loadSubscription(ctx context.Context, id string) (*domain.Subscription, error) {
+	subscription, err := s.subscriptionRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err := authorizeSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// updateSubscription applies mutate to the stored subscription and saves it,
+// starting over when another save wins the race.
+func (s *OrderService) updateSubscription(ctx context.Context, id string, mutate func(subscription *domain.Subscription) error) (*domain.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var subscription *domain.Subscription
+	err := retryOnConflict(ctx, func() error {
+		var err error
+		subscription, err = s.loadSubscription(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := mutate(subscription); err != nil {
+			return err
+		}
+		return s.subscriptionRepo.Update(ctx, subscription)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// RunSubscriptions places the orders of due subscriptions and retries their
+// failed payments every interval until ctx is done. Every replica may run
+// it: orders are placed and charged with idempotency keys of the run, the
+// attempt and the order, and a subscription saved by another replica is left
+// to it.
+func (s *OrderService) RunSubscriptions(ctx context.Context, interval time.Duration, dunning DunningPolicy) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.runSubscriptions(ctx, dunning)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *OrderService) runSubscriptions(ctx context.Context, dunning DunningPolicy) {
+	subscriptions, err := s.subscriptionRepo.FindDue(ctx, time.Now(), subscriptionBatch)
+	if err != nil {
+		log.Printf("failed to find due subscriptions: %v", err)
+		return
+	}
+
+	for i := range subscriptions {
+		err := s.runSubscription(ctx, &subscriptions[i], dunning)
+		if err != nil && !errors.Is(err, repository.ErrConflict) {
+			log.Printf("failed to run subscription %s: %v", subscriptions[i].ID, err)
+		}
+	}
+}
+
+// runSubscription places the order of the current run, or picks up the one
+// placed before, and charges it. It acts as the subscription, with an
+// internal context, since the scheduler carries no user token.
+func (s *OrderService) runSubscription(ctx context.Context, subscription *domain.Subscription, dunning DunningPolicy) error {
+	ctx = auth.NewInternalContext(ctx, "subscription:"+subscription.ID)
+
+	// Keys name the run, the attempt and the order, so a replica repeating a
+	// step gets the order and payment of the first one
+	key := fmt.Sprintf("subscription:%s:%d:%d", subscription.ID, subscription.NextRunAt.Unix(), subscription.PaymentAttempts)
+	orderKey := key
+
+	var order *domain.Order
+	if subscription.PendingOrderID != "" {
+		var err error
+		order, err = s.orderRepo.FindByID(ctx, subscription.PendingOrderID)
+		if err != nil {
+			return err
+		}
+		// An order that expired before it was charged is placed again, under
+		// a key of its own so that the expired order is not replayed
+		if order != nil && order.Status == domain.OrderStatusCancelled && expiredUnpaid(order) {
+			orderKey = key + ":replaces:" + order.ID
+			order = nil
+		}
+	}
+
+	if order == nil {
+		var err error
+		order, err = s.CreateOrder(ctx, subscription.UserID, subscription.Currency, subscriptionOrderItems(subscription.Items), subscription.Delivery(), "", orderKey)
+		if inProgress(err) {
+			return nil
+		}
+		if err != nil {
+			return s.failSubscriptionPayment(ctx, subscription, nil, err, dunning)
+		}
+
+		// Remember the order before charging it, so that a crash before the
+		// run ends does not leave it unknown to the subscription
+		subscription.PendingOrderID = order.ID
+		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+			return err
+		}
+	}
+
+	if order.Status == domain.OrderStatusPending || order.Status == domain.OrderStatusFailed {
+		paid, err := s.ProcessPayment(ctx, order.ID, subscription.PaymentMethod, key+":payment:"+order.ID)
+		if inProgress(err) {
+			return nil
+		}
+		if err != nil {
+			return s.failSubscriptionPayment(ctx, subscription, order, err, dunning)
+		}
+		order = paid
+	}
+
+	switch order.Status {
+	case domain.OrderStatusPaymentPending:
+		// The gateway answers later, look again on the next run
+		now := time.Now()
+		subscription.RetryAt = &now
+		return s.subscriptionRepo.Update(ctx, subscription)
+	case domain.OrderStatusFailed:
+		return s.failSubscriptionPayment(ctx, subscription, order, errPaymentDeclined, dunning)
+	}
+
+	// The order is paid, or was cancelled or refunded by hand, which ends
+	// the run too
+	subscription.LastOrderID = order.ID
+	subscription.PendingOrderID = ""
+	subscription.PaymentAttempts = 0
+	subscription.RetryAt = nil
+	subscription.LastError = ""
+	subscription.NextRunAt = subscription.Schedule.Next(subscription.NextRunAt)
+	subscription.SkipTo(time.Now())
+	return s.subscriptionRepo.Update(ctx, subscription)
+}
+
+// failSubscriptionPayment schedules the next attempt of a run that could not
+// be ordered or paid. The last attempt cancels the order, pauses the
+// subscription until the user resumes it and moves on to the next run.
+func (s *OrderService) failSubscriptionPayment(ctx context.Context, subscription *domain.Subscription, order *domain.Order, cause error, dunning DunningPolicy) error {
+	subscription.PaymentAttempts++
+	subscription.LastError = cause.Error()
+
+	if subscription.PaymentAttempts < dunning.MaxAttempts {
+		retryAt := time.Now().Add(dunning.retryDelay(subscription.PaymentAttempts))
+		subscription.RetryAt = &retryAt
+		return s.subscriptionRepo.Update(ctx, subscription)
+	}
+
+	event := domain.SubscriptionPaymentFailedEvent{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		OrderID:        subscription.PendingOrderID,
+		Attempts:       subscription.PaymentAttempts,
+		Reason:         subscription.LastError,
+		FailedAt:       time.Now(),
+	}
+	subscription.Status = domain.SubscriptionStatusPaused
+	subscription.PauseReason = subscriptionFailedReason
+	subscription.PendingOrderID = ""
+	subscription.PaymentAttempts = 0
+	subscription.RetryAt = nil
+	subscription.NextRunAt = subscription.Schedule.Next(subscription.NextRunAt)
+
+	// Save the subscription together with its SubscriptionPaymentFailed event
+	err := s.saveWithEvent(ctx, func(ctx context.Context) error {
+		return s.subscriptionRepo.Update(ctx, subscription)
+	}, "subscription.payment_failed", subscription.ID, event)
+	if err != nil {
+		return err
+	}
+
+	if order != nil {
+		s.cancelSubscriptionOrder(ctx, order.ID, subscriptionDunningReason)
+	}
+	return nil
+}
+
+// cancelSubscriptionOrder cancels an unpaid order of a subscription. An order
+// that got paid in the meantime is kept.
+func (s *OrderService) cancelSubscriptionOrder(ctx context.Context, orderID, reason string) {
+	order, err := s.orderRepo.FindByID(ctx, orderID)
+	if err != nil || order == nil {
+		log.Printf("failed to load subscription order %s: %v", orderID, err)
+		return
+	}
+	switch order.Status {
+	case domain.OrderStatusPending, domain.OrderStatusPaymentPending, domain.OrderStatusFailed:
+	default:
+		return
+	}
+	if _, err := s.CancelOrder(ctx, orderID, domain.ActorSystem, reason); err != nil {
+		log.Printf("failed to cancel subscription order %s: %v", orderID, err)
+	}
+}
+
+// inProgress reports whether another replica is running the same step, which
+// is left to it.
+func inProgress(err error) bool {
+	return errors.Is(err, ErrRequestInProgress) || errors.Is(err, ErrCheckoutInProgress)
+}
+
+// expiredUnpaid reports whether the order was cancelled by the order expiry.
+func expiredUnpaid(order *domain.Order) bool {
+	n := len(order.StatusHistory)
+	return n > 0 && order.StatusHistory[n-1].Reason == orderExpiryReason
+}
+
+func subscriptionOrderItems(items []domain.SubscriptionItem) []domain.OrderItem {
+	orderItems := make([]domain.OrderItem, 0, len(items))
+	for _, item := range items {
+		orderItems = append(orderItems, domain.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+	return orderItems
+}
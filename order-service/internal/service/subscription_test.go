@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"order-service/gen/payment"
+	"order-service/gen/product"
+	"order-service/internal/client"
+	"order-service/internal/domain"
+	"order-service/internal/repository"
+	"shared/auth"
+	"shared/outbox"
+
+	"google.golang.org/grpc"
+)
+
+// The repositories below keep what the subscription run needs in memory.
+// Embedded interfaces leave the methods it does not call unimplemented.
+
+type memOrderRepo struct {
+	repository.OrderRepository
+	mu     sync.Mutex
+	orders map[string]domain.Order
+}
+
+func cloneOrder(order domain.Order) domain.Order {
+	order.Items = slices.Clone(order.Items)
+	order.SubOrders = slices.Clone(order.SubOrders)
+	order.StatusHistory = slices.Clone(order.StatusHistory)
+	order.Refunds = slices.Clone(order.Refunds)
+	return order
+}
+
+func (r *memOrderRepo) Create(ctx context.Context, order *domain.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order.Version = 1
+	r.orders[order.ID] = cloneOrder(*order)
+	return nil
+}
+
+func (r *memOrderRepo) FindByID(ctx context.Context, id string) (*domain.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	order = cloneOrder(order)
+	return &order, nil
+}
+
+func (r *memOrderRepo) Update(ctx context.Context, order *domain.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.orders[order.ID].Version != order.Version {
+		return &repository.ConflictError{OrderID: order.ID, Version: order.Version}
+	}
+	order.Version++
+	order.UpdatedAt = time.Now()
+	r.orders[order.ID] = cloneOrder(*order)
+	return nil
+}
+
+func (r *memOrderRepo) Claim(ctx context.Context, order *domain.Order) (bool, error) {
+	if err := r.Update(ctx, order); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+type memSagaRepo struct {
+	repository.SagaRepository
+	mu    sync.Mutex
+	sagas map[string]domain.CheckoutSaga
+	// busy makes every checkout look like it is run by another replica.
+	busy bool
+}
+
+func (r *memSagaRepo) Create(ctx context.Context, saga *domain.CheckoutSaga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.busy {
+		return repository.ErrSagaInProgress
+	}
+	r.sagas[saga.ID] = *saga
+	return nil
+}
+
+func (r *memSagaRepo) FindActiveByOrderID(ctx context.Context, orderID string) (*domain.CheckoutSaga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, saga := range r.sagas {
+		if saga.OrderID == orderID && !saga.Status.IsFinished() {
+			return &saga, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memSagaRepo) Update(ctx context.Context, saga *domain.CheckoutSaga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saga.CompletedSteps = slices.Clone(saga.CompletedSteps)
+	r.sagas[saga.ID] = *saga
+	return nil
+}
+
+type memIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]domain.IdempotencyRecord
+}
+
+func (r *memIdempotencyRepo) Begin(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.records[record.ID]; ok {
+		return &existing, nil
+	}
+	r.records[record.ID] = *record
+	return nil, nil
+}
+
+func (r *memIdempotencyRepo) Reclaim(ctx context.Context, id string, now, lockedUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := r.records[id]
+	if record.LockedUntil.After(now) {
+		return false, nil
+	}
+	record.LockedUntil = lockedUntil
+	r.records[id] = record
+	return true, nil
+}
+
+func (r *memIdempotencyRepo) Complete(ctx context.Context, id string, response []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := r.records[id]
+	record.Status = domain.IdempotencyStatusCompleted
+	record.Response = response
+	r.records[id] = record
+	return nil
+}
+
+func (r *memIdempotencyRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, id)
+	return nil
+}
+
+type memSubscriptionRepo struct {
+	repository.SubscriptionRepository
+	mu            sync.Mutex
+	subscriptions map[string]domain.Subscription
+}
+
+func (r *memSubscriptionRepo) Update(ctx context.Context, subscription *domain.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.subscriptions[subscription.ID].Version != subscription.Version {
+		return repository.ErrConflict
+	}
+	subscription.Version++
+	r.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+type memPromotionRepo struct {
+	repository.PromotionRepository
+}
+
+func (memPromotionRepo) FindAutomatic(ctx context.Context, now time.Time) ([]domain.Promotion, error) {
+	return nil, nil
+}
+
+type memOutboxRepo struct {
+	outbox.Repository
+}
+
+func (memOutboxRepo) Add(ctx context.Context, message *outbox.Message) error {
+	return nil
+}
+
+type inlineTransactor struct{}
+
+func (inlineTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// fakeProductServer sells every product for 10.00 USD and reserves any stock.
+type fakeProductServer struct {
+	product.UnimplementedProductServiceServer
+}
+
+func (fakeProductServer) GetProductDetails(ctx context.Context, req *product.GetProductDetailsRequest) (*product.GetProductDetailsResponse, error) {
+	resp := &product.GetProductDetailsResponse{}
+	for _, id := range req.ProductIds {
+		resp.Products = append(resp.Products, &product.ProductDetail{
+			Id:    id,
+			Name:  id,
+			Price: &product.Money{Amount: 1000, Currency: "USD"},
+		})
+	}
+	return resp, nil
+}
+
+func (fakeProductServer) ReserveStock(ctx context.Context, req *product.ReserveStockRequest) (*product.ReservationResponse, error) {
+	return &product.ReservationResponse{ReservationId: "reservation-" + req.OrderId, Status: "active"}, nil
+}
+
+func (fakeProductServer) CommitReservation(ctx context.Context, req *product.ReservationRequest) (*product.ReservationResponse, error) {
+	return &product.ReservationResponse{ReservationId: req.ReservationId, Status: "committed"}, nil
+}
+
+func (fakeProductServer) ReleaseReservation(ctx context.Context, req *product.ReservationRequest) (*product.ReservationResponse, error) {
+	return &product.ReservationResponse{ReservationId: req.ReservationId, Status: "released"}, nil
+}
+
+// fakePaymentServer accepts every payment and remembers the orders charged.
+type fakePaymentServer struct {
+	payment.UnimplementedPaymentServiceServer
+	mu      sync.Mutex
+	charged []string
+}
+
+func (p *fakePaymentServer) CreatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.charged = append(p.charged, req.OrderId)
+	return &payment.PaymentResponse{PaymentId: "payment-" + req.OrderId, Status: domain.PaymentStatusSuccess}, nil
+}
+
+func serveGRPC(t *testing.T, register func(server *grpc.Server)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+type subscriptionTest struct {
+	service       *OrderService
+	orders        *memOrderRepo
+	sagas         *memSagaRepo
+	subscriptions *memSubscriptionRepo
+	payments      *fakePaymentServer
+}
+
+func newSubscriptionTest(t *testing.T) *subscriptionTest {
+	t.Helper()
+	payments := &fakePaymentServer{}
+	opts := client.Options{Timeout: time.Second, BreakerFailureThreshold: 5, BreakerOpenTimeout: time.Second}
+
+	productCli, err := client.NewProductClient(serveGRPC(t, func(server *grpc.Server) {
+		product.RegisterProductServiceServer(server, fakeProductServer{})
+	}), opts)
+	if err != nil {
+		t.Fatalf("NewProductClient() error = %v", err)
+	}
+	t.Cleanup(func() { productCli.Close() })
+	paymentCli, err := client.NewPaymentClient(serveGRPC(t, func(server *grpc.Server) {
+		payment.RegisterPaymentServiceServer(server, payments)
+	}), opts)
+	if err != nil {
+		t.Fatalf("NewPaymentClient() error = %v", err)
+	}
+	t.Cleanup(func() { paymentCli.Close() })
+
+	st := &subscriptionTest{
+		orders:        &memOrderRepo{orders: make(map[string]domain.Order)},
+		sagas:         &memSagaRepo{sagas: make(map[string]domain.CheckoutSaga)},
+		subscriptions: &memSubscriptionRepo{subscriptions: make(map[string]domain.Subscription)},
+		payments:      payments,
+	}
+	st.service = NewOrderService(
+		st.orders, st.sagas, memOutboxRepo{},
+		&memIdempotencyRepo{records: make(map[string]domain.IdempotencyRecord)},
+		memPromotionRepo{}, nil, st.subscriptions, inlineTransactor{},
+		productCli, paymentCli,
+		PriceMismatchReject, TaxTable{}, nil, 0,
+		time.Minute, 24*time.Hour, time.Hour, nil, time.Second,
+	)
+	return st
+}
+
+func TestRunSubscriptionReplacesExpiredOrder(t *testing.T) {
+	st := newSubscriptionTest(t)
+	ctx := context.Background()
+	dunning := DunningPolicy{MaxAttempts: 3, RetryDelay: time.Hour}
+
+	subscription := domain.Subscription{
+		ID:            "subscription-1",
+		UserID:        "user-1",
+		Items:         []domain.SubscriptionItem{{ProductID: "coffee", Quantity: 2}},
+		Schedule:      domain.Schedule{Unit: domain.ScheduleUnitMonth, Every: 1},
+		NextRunAt:     time.Now().Add(-time.Minute),
+		PaymentMethod: "card",
+		Status:        domain.SubscriptionStatusActive,
+	}
+	st.subscriptions.subscriptions[subscription.ID] = subscription
+
+	// The first order is placed, but another replica is still charging it
+	st.sagas.busy = true
+	if err := st.service.runSubscription(ctx, &subscription, dunning); err != nil {
+		t.Fatalf("first run: runSubscription() error = %v", err)
+	}
+	expiredID := subscription.PendingOrderID
+	if expiredID == "" {
+		t.Fatal("first run did not record its order")
+	}
+
+	// That charge never happens and the order expires unpaid
+	st.sagas.busy = false
+	expired, _ := st.orders.FindByID(ctx, expiredID)
+	if err := st.service.expireOrder(auth.NewInternalContext(ctx, "order-expiry"), expired); err != nil {
+		t.Fatalf("expireOrder() error = %v", err)
+	}
+	if expired.Status != domain.OrderStatusCancelled {
+		t.Fatalf("expired order status = %s, want %s", expired.Status, domain.OrderStatusCancelled)
+	}
+
+	if err := st.service.runSubscription(ctx, &subscription, dunning); err != nil {
+		t.Fatalf("second run: runSubscription() error = %v", err)
+	}
+
+	placedID := subscription.LastOrderID
+	if placedID == "" || placedID == expiredID {
+		t.Fatalf("LastOrderID = %q, want an order other than the expired %q", placedID, expiredID)
+	}
+	placed, _ := st.orders.FindByID(ctx, placedID)
+	if placed == nil || placed.Status != domain.OrderStatusPaid {
+		t.Fatalf("new order = %+v, want it paid", placed)
+	}
+	if !slices.Equal(st.payments.charged, []string{placedID}) {
+		t.Errorf("charged orders = %v, want [%s]", st.payments.charged, placedID)
+	}
+	if subscription.PendingOrderID != "" || subscription.PaymentAttempts != 0 || subscription.LastError != "" {
+		t.Errorf("subscription = pending %q, attempts %d, error %q; want the run finished cleanly",
+			subscription.PendingOrderID, subscription.PaymentAttempts, subscription.LastError)
+	}
+}
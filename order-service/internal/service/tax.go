@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"order-service/internal/domain"
+	"shared/money"
+)
+
+var ErrInvalidTaxRate = errors.New("invalid tax rate")
+
+// basisPoints is 100%.
+const basisPoints = 10000
+
+// TaxTable holds the tax rates by destination and product tax category and
+// whether catalog prices include them.
+type TaxTable struct {
+	Mode  domain.TaxMode
+	Rates []domain.TaxRate
+}
+
+// NewTaxTable parses the tax mode and rates. Rates are written as
+// COUNTRY[-REGION][:CATEGORY]=BASIS_POINTS, e.g. "ID=1100" for 11% on
+// everything shipped to Indonesia or "ID:basic_food=0" to exempt a category.
+func NewTaxTable(mode string, rates []string) (TaxTable, error) {
+	table := TaxTable{Mode: domain.TaxMode(mode)}
+	if table.Mode != domain.TaxExclusive && table.Mode != domain.TaxInclusive {
+		return TaxTable{}, fmt.Errorf("%w: unknown mode %q", ErrInvalidTaxRate, mode)
+	}
+
+	for _, entry := range rates {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return TaxTable{}, fmt.Errorf("%w: %q", ErrInvalidTaxRate, entry)
+		}
+		bps, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || bps < 0 || bps > basisPoints {
+			return TaxTable{}, fmt.Errorf("%w: %q", ErrInvalidTaxRate, entry)
+		}
+
+		place, category, _ := strings.Cut(target, ":")
+		country, region, _ := strings.Cut(place, "-")
+		if country == "" {
+			return TaxTable{}, fmt.Errorf("%w: %q", ErrInvalidTaxRate, entry)
+		}
+		table.Rates = append(table.Rates, domain.TaxRate{
+			Country:     strings.ToUpper(country),
+			Region:      strings.ToUpper(region),
+			Category:    category,
+			BasisPoints: bps,
+		})
+	}
+	return table, nil
+}
+
+// rate returns the most specific rate for the destination and category: a
+// rate for both the region and the category, then one for the category, then
+// one for the region and last the country rate. A category rate thus
+// exempts its products everywhere in the country, even where a region has a
+// rate of its own. Orders without a matching rate are not taxed.
+func (t TaxTable) rate(destination *domain.Destination, category string) int64 {
+	if destination == nil {
+		return 0
+	}
+	country := strings.ToUpper(destination.Country)
+	region := strings.ToUpper(destination.Region)
+
+	best, bestScore := int64(0), -1
+	for _, r := range t.Rates {
+		if r.Country != country {
+			continue
+		}
+		if (r.Region != "" && r.Region != region) || (r.Category != "" && r.Category != category) {
+			continue
+		}
+		score := 0
+		if r.Category != "" {
+			score += 2
+		}
+		if r.Region != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = r.BasisPoints, score
+		}
+	}
+	return best
+}
+
+// applyTax computes the tax of every line and the order tax total. Tax is
+// charged on what the customer pays, so each line is taxed after the
+// discounts the promotions gave on it. Exclusive tax is added to the total,
+// inclusive tax is already part of it.
+func (s *OrderService) applyTax(order *domain.Order) error {
+	currency := order.Subtotal.Currency
+	taxTotal := money.Zero(currency)
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.TaxRate = s.taxes.rate(order.Destination, item.TaxCategory)
+
+		base := item.Price.Mul(int64(item.Quantity))
+		if !item.Discount.IsZero() {
+			var err error
+			base, err = base.Sub(item.Discount)
+			if err != nil {
+				return err
+			}
+			if base.IsNegative() {
+				base = money.Zero(currency)
+			}
+		}
+
+		if s.taxes.Mode == domain.TaxInclusive {
+			item.Tax = base.MulRatio(item.TaxRate, basisPoints+item.TaxRate)
+		} else {
+			item.Tax = base.MulRatio(item.TaxRate, basisPoints)
+		}
+
+		var err error
+		taxTotal, err = taxTotal.Add(item.Tax)
+		if err != nil {
+			return err
+		}
+	}
+
+	order.TaxMode = s.taxes.Mode
+	order.TaxTotal = taxTotal
+	if s.taxes.Mode == domain.TaxExclusive {
+		total, err := order.Total.Add(taxTotal)
+		if err != nil {
+			return err
+		}
+		order.Total = total
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"order-service/internal/domain"
+)
+
+func TestTaxTableRate(t *testing.T) {
+	table, err := NewTaxTable("inclusive", []string{
+		"ID=1100",
+		"ID:basic_food=0",
+		"ID-BA=1200",
+		"ID-BA:alcohol=4000",
+		"US-CA=725",
+	})
+	if err != nil {
+		t.Fatalf("NewTaxTable() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		destination *domain.Destination
+		category    string
+		want        int64
+	}{
+		{"country rate", &domain.Destination{Country: "ID"}, "", 1100},
+		{"country codes ignore case", &domain.Destination{Country: "id"}, "", 1100},
+		{"category rate", &domain.Destination{Country: "ID"}, "basic_food", 0},
+		{"region rate", &domain.Destination{Country: "ID", Region: "BA"}, "", 1200},
+		{"category beats region", &domain.Destination{Country: "ID", Region: "BA"}, "basic_food", 0},
+		{"region and category", &domain.Destination{Country: "ID", Region: "BA"}, "alcohol", 4000},
+		{"region category elsewhere in the country", &domain.Destination{Country: "ID", Region: "JK"}, "alcohol", 1100},
+		{"unknown region falls back to the country", &domain.Destination{Country: "ID", Region: "JK"}, "", 1100},
+		{"region without a country rate", &domain.Destination{Country: "US", Region: "NY"}, "", 0},
+		{"untaxed country", &domain.Destination{Country: "SG"}, "", 0},
+		{"no destination", nil, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.rate(tt.destination, tt.category); got != tt.want {
+				t.Errorf("rate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTaxTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		rates   []string
+		wantErr error
+	}{
+		{"inclusive", "inclusive", []string{"ID=1100"}, nil},
+		{"exclusive with blanks", "exclusive", []string{"", " ID=1100 "}, nil},
+		{"unknown mode", "gross", nil, ErrInvalidTaxRate},
+		{"missing rate", "inclusive", []string{"ID"}, ErrInvalidTaxRate},
+		{"rate over 100%", "inclusive", []string{"ID=10001"}, ErrInvalidTaxRate},
+		{"negative rate", "inclusive", []string{"ID=-1"}, ErrInvalidTaxRate},
+		{"missing country", "inclusive", []string{":food=0"}, ErrInvalidTaxRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTaxTable(tt.mode, tt.rates); !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewTaxTable() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyTax(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		items     []domain.OrderItem
+		wantTaxes []int64
+		wantTotal int64
+	}{
+		{
+			name:      "inclusive tax is part of the total",
+			mode:      "inclusive",
+			items:     []domain.OrderItem{{Quantity: 1, Price: usd(11100)}},
+			wantTaxes: []int64{1100},
+			wantTotal: 11100,
+		},
+		{
+			name:      "exclusive tax is added to the total",
+			mode:      "exclusive",
+			items:     []domain.OrderItem{{Quantity: 2, Price: usd(1000)}},
+			wantTaxes: []int64{220},
+			wantTotal: 2220,
+		},
+		{
+			name:      "lines are taxed after their discounts",
+			mode:      "exclusive",
+			items:     []domain.OrderItem{{Quantity: 1, Price: usd(1000), Discount: usd(500)}, {Quantity: 1, Price: usd(1000)}},
+			wantTaxes: []int64{55, 110},
+			wantTotal: 1665,
+		},
+		{
+			name:      "exempt category",
+			mode:      "exclusive",
+			items:     []domain.OrderItem{{Quantity: 1, Price: usd(1000), TaxCategory: "basic_food"}},
+			wantTaxes: []int64{0},
+			wantTotal: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxes, err := NewTaxTable(tt.mode, []string{"ID=1100", "ID:basic_food=0"})
+			if err != nil {
+				t.Fatalf("NewTaxTable() error = %v", err)
+			}
+			s := &OrderService{taxes: taxes}
+
+			order := &domain.Order{
+				Items:       tt.items,
+				Destination: &domain.Destination{Country: "ID"},
+			}
+			order.Subtotal = usd(0)
+			for _, item := range tt.items {
+				order.Subtotal.Amount += item.Price.Amount * int64(item.Quantity)
+				order.Subtotal.Amount -= item.Discount.Amount
+			}
+			order.Total = order.Subtotal
+
+			if err := s.applyTax(order); err != nil {
+				t.Fatalf("applyTax() error = %v", err)
+			}
+			for i, want := range tt.wantTaxes {
+				if got := order.Items[i].Tax; got != usd(want) {
+					t.Errorf("Items[%d].Tax = %v, want %v", i, got, usd(want))
+				}
+			}
+			if order.Total != usd(tt.wantTotal) {
+				t.Errorf("Total = %v, want %v", order.Total, usd(tt.wantTotal))
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package eventbus
+
+import "context"
+
+type EventBus interface {
+	// Publish sends the event to topic. Events with the same key go to the
+	// same partition and keep their order.
+	Publish(topic, key string, event interface{}) error
+	Close() error
+}
+
+// Handler processes the payload of a consumed message. Returning an error
+// has the message delivered again.
+type Handler func(ctx context.Context, payload []byte) error
@@ -0,0 +1,60 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type KafkaEventBus struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaEventBus(brokers []string) *KafkaEventBus {
+	// Writes are synchronous so that the outbox relay only marks messages
+	// delivered once Kafka has acknowledged them. Keyed messages are hashed
+	// to a partition, the others spread round robin.
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	return &KafkaEventBus{
+		writer: writer,
+	}
+}
+
+func (k *KafkaEventBus) Publish(topic, key string, event interface{}) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var messageKey []byte
+	if key != "" {
+		messageKey = []byte(key)
+	}
+	err = k.writer.WriteMessages(context.Background(),
+		kafka.Message{
+			Topic: topic,
+			Key:   messageKey,
+			Value: message,
+		},
+	)
+
+	if err != nil {
+		log.Printf("failed to write message to kafka: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (k *KafkaEventBus) Close() error {
+	return k.writer.Close()
+}
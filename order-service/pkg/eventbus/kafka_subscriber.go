@@ -0,0 +1,80 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// maxFetchBackoff caps the wait between failed fetches.
+const maxFetchBackoff = 30 * time.Second
+
+// KafkaSubscriber consumes a topic as part of a consumer group. Messages are
+// committed once the handler accepts them, so a message whose handler fails
+// is delivered again.
+type KafkaSubscriber struct {
+	reader *kafka.Reader
+}
+
+func NewKafkaSubscriber(brokers []string, groupID, topic string) *KafkaSubscriber {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		GroupID: groupID,
+		Topic:   topic,
+	})
+
+	return &KafkaSubscriber{
+		reader: reader,
+	}
+}
+
+// Run passes every message to handler until ctx is done. A failed message is
+// retried after retryDelay before the subscriber moves on. Fetching backs off
+// from retryDelay up to maxFetchBackoff while the brokers keep failing.
+func (k *KafkaSubscriber) Run(ctx context.Context, handler Handler, retryDelay time.Duration) {
+	fetchBackoff := retryDelay
+	for {
+		message, err := k.reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) {
+				return
+			}
+			log.Printf("failed to fetch message from kafka, retrying in %s: %v", fetchBackoff, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fetchBackoff):
+			}
+			fetchBackoff = min(fetchBackoff*2, maxFetchBackoff)
+			continue
+		}
+		fetchBackoff = retryDelay
+
+		for {
+			err := handler(ctx, message.Value)
+			if err == nil {
+				break
+			}
+			log.Printf("failed to handle message from %s: %v", message.Topic, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+		}
+
+		if err := k.reader.CommitMessages(ctx, message); err != nil {
+			log.Printf("failed to commit message from %s: %v", message.Topic, err)
+		}
+	}
+}
+
+func (k *KafkaSubscriber) Close() error {
+	return k.reader.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"payment-service/gen/payment"
+	"payment-service/internal/config"
+	"payment-service/internal/gateway"
+	"payment-service/internal/handler"
+	"payment-service/internal/repository"
+	"payment-service/internal/service"
+	"payment-service/pkg/eventbus"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	// Initialize MongoDB
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mongoClient, err := mongo.Connect(mongoCtx, options.Client().ApplyURI(cfg.MongoURI))
+	if err != nil {
+		log.Fatalf("failed to connect to mongodb: %v", err)
+	}
+	defer func() {
+		if err = mongoClient.Disconnect(context.Background()); err != nil {
+			log.Printf("failed to disconnect mongodb: %v", err)
+		}
+	}()
+
+	// Initialize Kafka Event Bus
+	eventBus := eventbus.NewKafkaEventBus(cfg.KafkaBrokers)
+	defer eventBus.Close()
+
+	// Initialize Gateway
+	paymentGateway, err := newGateway(cfg)
+	if err != nil {
+		log.Fatalf("failed to create payment gateway: %v", err)
+	}
+
+	// Initialize Repository
+	paymentRepo := repository.NewMongoPaymentRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := paymentRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create payment indexes: %v", err)
+	}
+	transactionRepo := repository.NewMongoTransactionRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := transactionRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create transaction indexes: %v", err)
+	}
+
+	// Initialize Services
+	paymentService := service.NewPaymentService(
+		paymentRepo, transactionRepo,
+		paymentGateway, eventBus,
+		[]byte(cfg.PaymentNotificationSecret),
+		5*time.Second,
+	)
+
+	// Settle pending payments
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go paymentService.RunSettlement(workerCtx, cfg.SettlementInterval)
+
+	// Initialize gRPC Server
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(handler.ErrorInterceptor),
+	)
+
+	// Register Services
+	paymentHandler := handler.NewPaymentGRPCHandler(paymentService)
+	payment.RegisterPaymentServiceServer(grpcServer, paymentHandler)
+	reflection.Register(grpcServer)
+
+	// Start gRPC Server
+	listener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	go func() {
+		log.Printf("gRPC server listening on %s", listener.Addr())
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("shutting down gRPC server...")
+
+	grpcServer.GracefulStop()
+	log.Println("server exited")
+}
+
+// newGateway returns the gateway adapter selected by the configuration.
+func newGateway(cfg *config.Config) (gateway.Gateway, error) {
+	switch cfg.Gateway {
+	case "fake":
+		return gateway.NewFakeGateway(cfg.FakeGatewayScenario, cfg.FakeGatewaySettleAfter, cfg.FakeGatewayBaseURL)
+	default:
+		return nil, fmt.Errorf("unknown payment gateway %q", cfg.Gateway)
+	}
+}
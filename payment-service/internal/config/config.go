@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	GRPCPort     string
+	MongoURI     string
+	MongoDB      string
+	KafkaBrokers []string
+	// Gateway selects the payment gateway adapter.
+	Gateway string
+	// PaymentNotificationSecret is shared with the order service to sign
+	// payment notifications.
+	PaymentNotificationSecret string
+	SettlementInterval        time.Duration
+	FakeGatewayScenario       string
+	FakeGatewaySettleAfter    time.Duration
+	FakeGatewayBaseURL        string
+}
+
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Println("no .env file found")
+	}
+
+	notificationSecret := getEnv("PAYMENT_NOTIFICATION_SECRET", "")
+	if notificationSecret == "" {
+		return nil, errors.New("PAYMENT_NOTIFICATION_SECRET is required")
+	}
+
+	return &Config{
+		GRPCPort:                  getEnv("GRPC_PORT", "50053"),
+		MongoURI:                  getEnv("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:                   getEnv("MONGO_DB", "payment_service"),
+		KafkaBrokers:              getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
+		Gateway:                   getEnv("PAYMENT_GATEWAY", "fake"),
+		PaymentNotificationSecret: notificationSecret,
+		SettlementInterval:        getEnvAsDuration("SETTLEMENT_INTERVAL", 5*time.Second),
+		FakeGatewayScenario:       getEnv("FAKE_GATEWAY_SCENARIO", "success"),
+		FakeGatewaySettleAfter:    getEnvAsDuration("FAKE_GATEWAY_SETTLE_AFTER", 10*time.Second),
+		FakeGatewayBaseURL:        getEnv("FAKE_GATEWAY_BASE_URL", "http://localhost:8090"),
+	}, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValues []string, sep string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		return strings.Split(value, sep)
+	}
+	return defaultValues
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("invalid duration for %s, using default %s", key, defaultValue)
+	}
+	return defaultValue
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"time"
+
+	"shared/money"
+	"shared/signature"
+)
+
+type PaymentStatus string
+
+const (
+	// PaymentStatusPending payments wait for the gateway to report the
+	// outcome, e.g. after the user was redirected to PaymentURL.
+	PaymentStatusPending  PaymentStatus = "pending"
+	PaymentStatusSuccess  PaymentStatus = "success"
+	PaymentStatusFailed   PaymentStatus = "failed"
+	PaymentStatusRefunded PaymentStatus = "refunded"
+)
+
+type Payment struct {
+	ID             string        `json:"id" bson:"_id"`
+	OrderID        string        `json:"order_id" bson:"order_id"`
+	UserID         string        `json:"user_id" bson:"user_id"`
+	Method         string        `json:"method" bson:"method"`
+	Amount         money.Money   `json:"amount" bson:"amount"`
+	RefundedAmount money.Money   `json:"refunded_amount" bson:"refunded_amount"`
+	Status         PaymentStatus `json:"status" bson:"status"`
+	Gateway        string        `json:"gateway" bson:"gateway"`
+	GatewayRef     string        `json:"gateway_ref,omitempty" bson:"gateway_ref,omitempty"`
+	PaymentURL     string        `json:"payment_url,omitempty" bson:"payment_url,omitempty"`
+	IdempotencyKey string        `json:"idempotency_key,omitempty" bson:"idempotency_key,omitempty"`
+	// PendingRefunds are the refunds whose amount is already counted in
+	// RefundedAmount while the gateway has not confirmed them.
+	PendingRefunds []string `json:"pending_refunds,omitempty" bson:"pending_refunds,omitempty"`
+	// Notified is false while the outcome of the payment has not been
+	// published yet.
+	Notified  bool      `json:"notified" bson:"notified"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+func (s PaymentStatus) IsFinal() bool {
+	return s != PaymentStatusPending
+}
+
+type TransactionType string
+
+const (
+	TransactionTypeCharge     TransactionType = "charge"
+	TransactionTypeSettlement TransactionType = "settlement"
+	TransactionTypeRefund     TransactionType = "refund"
+)
+
+type TransactionStatus string
+
+const (
+	TransactionStatusSuccess TransactionStatus = "success"
+	TransactionStatusPending TransactionStatus = "pending"
+	TransactionStatusFailed  TransactionStatus = "failed"
+)
+
+// Transaction is a record of an exchange with the gateway. Refunds are
+// recorded pending before the gateway is called and completed with its
+// outcome; every other transaction is only ever appended.
+type Transaction struct {
+	ID             string            `json:"id" bson:"_id"`
+	PaymentID      string            `json:"payment_id" bson:"payment_id"`
+	OrderID        string            `json:"order_id" bson:"order_id"`
+	Type           TransactionType   `json:"type" bson:"type"`
+	Status         TransactionStatus `json:"status" bson:"status"`
+	Amount         money.Money       `json:"amount" bson:"amount"`
+	GatewayRef     string            `json:"gateway_ref,omitempty" bson:"gateway_ref,omitempty"`
+	Message        string            `json:"message,omitempty" bson:"message,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty" bson:"idempotency_key,omitempty"`
+	// ClaimedUntil is when the request working on a pending refund gives up
+	// its claim, after which a retry may take the refund over.
+	ClaimedUntil time.Time `json:"claimed_until,omitempty" bson:"claimed_until,omitempty"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+// PaymentNotification reports the outcome of a payment. It is signed with
+// the secret shared with the order service.
+type PaymentNotification struct {
+	PaymentID  string      `json:"payment_id"`
+	OrderID    string      `json:"order_id"`
+	Status     string      `json:"status"`
+	Amount     money.Money `json:"amount"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Signature  string      `json:"signature"`
+}
+
+// SignedPayload returns the content covered by the notification signature.
+func (n PaymentNotification) SignedPayload() string {
+	return signature.PaymentNotificationPayload(n.PaymentID, n.OrderID, n.Status, n.Amount, n.OccurredAt)
+}
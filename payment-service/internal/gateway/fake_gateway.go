@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment-service/internal/domain"
+)
+
+// Scenarios of the fake gateway. A payment whose method names a scenario
+// plays that scenario, any other payment plays the default one.
+const (
+	ScenarioSuccess        = "success"
+	ScenarioDecline        = "decline"
+	ScenarioPending        = "pending"
+	ScenarioPendingDecline = "pending_decline"
+)
+
+var ErrUnknownReference = errors.New("unknown gateway reference")
+
+// FakeGateway is a deterministic gateway for local development and tests.
+// It keeps no state: the scenario and start time of a charge are encoded in
+// its reference, and pending charges settle settleAfter after they started.
+type FakeGateway struct {
+	defaultScenario string
+	settleAfter     time.Duration
+	baseURL         string
+}
+
+func NewFakeGateway(defaultScenario string, settleAfter time.Duration, baseURL string) (*FakeGateway, error) {
+	if !isScenario(defaultScenario) {
+		return nil, fmt.Errorf("unknown fake gateway scenario %q", defaultScenario)
+	}
+
+	return &FakeGateway{
+		defaultScenario: defaultScenario,
+		settleAfter:     settleAfter,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	scenario := g.defaultScenario
+	if isScenario(req.Method) {
+		scenario = req.Method
+	}
+
+	reference := fmt.Sprintf("fake_%s_%d_%s", scenario, time.Now().UnixMilli(), req.PaymentID)
+	return g.result(reference, scenario, time.Now())
+}
+
+func (g *FakeGateway) Status(ctx context.Context, reference string) (*ChargeResult, error) {
+	scenario, startedAt, err := parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	return g.result(reference, scenario, startedAt)
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	if _, _, err := parseReference(req.Reference); err != nil {
+		return nil, err
+	}
+
+	return &RefundResult{
+		Reference: "fake_refund_" + req.RefundID,
+		Status:    domain.TransactionStatusSuccess,
+	}, nil
+}
+
+func (g *FakeGateway) result(reference, scenario string, startedAt time.Time) (*ChargeResult, error) {
+	result := &ChargeResult{Reference: reference}
+
+	settled := time.Since(startedAt) >= g.settleAfter
+	switch {
+	case scenario == ScenarioSuccess, scenario == ScenarioPending && settled:
+		result.Status = domain.PaymentStatusSuccess
+	case scenario == ScenarioDecline, scenario == ScenarioPendingDecline && settled:
+		result.Status = domain.PaymentStatusFailed
+		result.Message = "declined by fake gateway"
+	default:
+		result.Status = domain.PaymentStatusPending
+		result.PaymentURL = g.baseURL + "/pay/" + reference
+	}
+
+	return result, nil
+}
+
+// parseReference reads the scenario and start time back from a reference
+// of the form fake_<scenario>_<unix millis>_<payment id>.
+func parseReference(reference string) (string, time.Time, error) {
+	rest, ok := strings.CutPrefix(reference, "fake_")
+	if !ok {
+		return "", time.Time{}, ErrUnknownReference
+	}
+
+	for _, scenario := range []string{ScenarioPendingDecline, ScenarioPending, ScenarioSuccess, ScenarioDecline} {
+		tail, ok := strings.CutPrefix(rest, scenario+"_")
+		if !ok {
+			continue
+		}
+		millis, _, ok := strings.Cut(tail, "_")
+		if !ok {
+			break
+		}
+		startedAt, err := strconv.ParseInt(millis, 10, 64)
+		if err != nil {
+			break
+		}
+		return scenario, time.UnixMilli(startedAt), nil
+	}
+
+	return "", time.Time{}, ErrUnknownReference
+}
+
+func isScenario(name string) bool {
+	switch name {
+	case ScenarioSuccess, ScenarioDecline, ScenarioPending, ScenarioPendingDecline:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Package gateway adapts payment providers to a common interface.
+package gateway
+
+import (
+	"context"
+
+	"payment-service/internal/domain"
+	"shared/money"
+)
+
+// Gateway charges and refunds payments with a payment provider.
+type Gateway interface {
+	Name() string
+	// Charge starts a payment. Redirect based providers answer with a pending
+	// status and the URL to send the user to.
+	Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error)
+	// Status returns the current state of a charge started earlier.
+	Status(ctx context.Context, reference string) (*ChargeResult, error)
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+}
+
+type ChargeRequest struct {
+	PaymentID string
+	OrderID   string
+	Method    string
+	Amount    money.Money
+}
+
+type ChargeResult struct {
+	Reference  string
+	Status     domain.PaymentStatus
+	PaymentURL string
+	Message    string
+}
+
+type RefundRequest struct {
+	PaymentID string
+	RefundID  string
+	// Reference is the gateway reference of the charge being refunded.
+	Reference string
+	Amount    money.Money
+	Reason    string
+}
+
+type RefundResult struct {
+	Reference string
+	Status    domain.TransactionStatus
+	Message   string
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"payment-service/internal/service"
+	"shared/money"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain identifies this service in google.rpc.ErrorInfo details.
+const errorDomain = "payment-service"
+
+type errorMapping struct {
+	err    error
+	code   codes.Code
+	reason string
+}
+
+var errorMappings = []errorMapping{
+	{service.ErrPaymentNotFound, codes.NotFound, "PAYMENT_NOT_FOUND"},
+	{service.ErrInvalidPayment, codes.InvalidArgument, "INVALID_PAYMENT"},
+	{service.ErrInvalidRefund, codes.InvalidArgument, "INVALID_REFUND"},
+	{service.ErrIdempotencyKeyReused, codes.InvalidArgument, "IDEMPOTENCY_KEY_REUSED"},
+	{money.ErrUnsupportedCurrency, codes.InvalidArgument, "UNSUPPORTED_CURRENCY"},
+	{money.ErrCurrencyMismatch, codes.InvalidArgument, "CURRENCY_MISMATCH"},
+	{service.ErrRefundNotAllowed, codes.FailedPrecondition, "REFUND_NOT_ALLOWED"},
+	{service.ErrRefundInProgress, codes.Aborted, "REFUND_IN_PROGRESS"},
+	{service.ErrGatewayUnavailable, codes.Unavailable, "GATEWAY_UNAVAILABLE"},
+}
+
+// ErrorInterceptor turns the errors returned by the handlers into gRPC
+// statuses with google.rpc error details.
+func ErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return resp, nil
+}
+
+func toStatusError(err error) error {
+	for _, m := range errorMappings {
+		if !errors.Is(err, m.err) {
+			continue
+		}
+
+		st := status.New(m.code, err.Error())
+		if withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: m.reason, Domain: errorDomain}); detailsErr == nil {
+			st = withDetails
+		}
+		return st.Err()
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"log"
+
+	"payment-service/gen/payment"
+	"payment-service/internal/service"
+	"shared/money"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type PaymentGRPCHandler struct {
+	payment.UnimplementedPaymentServiceServer
+	service *service.PaymentService
+}
+
+func NewPaymentGRPCHandler(svc *service.PaymentService) *PaymentGRPCHandler {
+	return &PaymentGRPCHandler{
+		service: svc,
+	}
+}
+
+func (h *PaymentGRPCHandler) CreatePayment(ctx context.Context, req *payment.PaymentRequest) (*payment.PaymentResponse, error) {
+	// Call service
+	p, err := h.service.CreatePayment(ctx, req.OrderId, req.UserId, req.PaymentMethod, fromMoneyProto(req.Amount), req.IdempotencyKey)
+	if err != nil {
+		log.Printf("CreatePayment failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return &payment.PaymentResponse{
+		PaymentId:  p.ID,
+		Status:     string(p.Status),
+		PaymentUrl: p.PaymentURL,
+	}, nil
+}
+
+func (h *PaymentGRPCHandler) ProcessRefund(ctx context.Context, req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	// Call service
+	refund, err := h.service.ProcessRefund(ctx, req.PaymentId, req.OrderId, fromMoneyProto(req.Amount), req.Reason, req.IdempotencyKey)
+	if err != nil {
+		log.Printf("ProcessRefund failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	return &payment.RefundResponse{
+		RefundId: refund.ID,
+		Status:   string(refund.Status),
+	}, nil
+}
+
+func (h *PaymentGRPCHandler) GetPaymentStatus(ctx context.Context, req *payment.GetPaymentStatusRequest) (*payment.PaymentStatusResponse, error) {
+	// Call service
+	p, transactions, err := h.service.GetPaymentStatus(ctx, req.PaymentId, req.IdempotencyKey)
+	if err != nil {
+		log.Printf("GetPaymentStatus failed: %v", err)
+		return nil, err
+	}
+
+	// Convert response
+	resp := &payment.PaymentStatusResponse{
+		PaymentId:      p.ID,
+		OrderId:        p.OrderID,
+		Status:         string(p.Status),
+		Amount:         toMoneyProto(p.Amount),
+		RefundedAmount: toMoneyProto(p.RefundedAmount),
+		Gateway:        p.Gateway,
+		PaymentUrl:     p.PaymentURL,
+	}
+	for _, transaction := range transactions {
+		resp.Transactions = append(resp.Transactions, &payment.Transaction{
+			Id:               transaction.ID,
+			Type:             string(transaction.Type),
+			Status:           string(transaction.Status),
+			Amount:           toMoneyProto(transaction.Amount),
+			GatewayReference: transaction.GatewayRef,
+			Message:          transaction.Message,
+			CreatedAt:        timestamppb.New(transaction.CreatedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func toMoneyProto(m money.Money) *payment.Money {
+	return &payment.Money{
+		Amount:   m.Amount,
+		Currency: string(m.Currency),
+	}
+}
+
+func fromMoneyProto(m *payment.Money) money.Money {
+	if m == nil {
+		return money.Money{}
+	}
+	return money.New(m.Amount, money.Currency(m.Currency))
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"payment-service/internal/domain"
+	"shared/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoPaymentRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoPaymentRepository(db *mongo.Database, timeout time.Duration) *MongoPaymentRepository {
+	return &MongoPaymentRepository{
+		collection: db.Collection("payments"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes used by idempotent charges and the
+// settlement worker.
+func (r *MongoPaymentRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+		{Keys: bson.D{{Key: "notified", Value: 1}, {Key: "updated_at", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoPaymentRepository) Create(ctx context.Context, payment *domain.Payment) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, payment)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateIdempotencyKey
+	}
+	return err
+}
+
+func (r *MongoPaymentRepository) FindByID(ctx context.Context, id string) (*domain.Payment, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoPaymentRepository) FindByIdempotencyKey(ctx context.Context, key string) (*domain.Payment, error) {
+	return r.findOne(ctx, bson.M{"idempotency_key": key})
+}
+
+func (r *MongoPaymentRepository) Update(ctx context.Context, payment *domain.Payment) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	payment.UpdatedAt = time.Now()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": payment.ID}, payment)
+	return err
+}
+
+func (r *MongoPaymentRepository) MarkNotified(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"notified": true, "updated_at": time.Now()},
+	})
+	return err
+}
+
+func (r *MongoPaymentRepository) ReserveRefund(ctx context.Context, paymentID, refundID string, amount money.Money) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// The check and the increment are one update, so concurrent refunds
+	// can never add up to more than the payment
+	filter := bson.M{
+		"_id":             paymentID,
+		"status":          domain.PaymentStatusSuccess,
+		"amount.currency": amount.Currency,
+		"pending_refunds": bson.M{"$ne": refundID},
+		"$expr": bson.M{"$lte": bson.A{
+			bson.M{"$add": bson.A{"$refunded_amount.amount", amount.Amount}},
+			"$amount.amount",
+		}},
+	}
+	update := bson.M{
+		"$inc":  bson.M{"refunded_amount.amount": amount.Amount},
+		"$push": bson.M{"pending_refunds": refundID},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+
+	// A refund taken over after a crash was reserved by the first attempt
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": paymentID, "pending_refunds": refundID})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *MongoPaymentRepository) CompleteRefund(ctx context.Context, paymentID, refundID string, amount money.Money, paid bool) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"_id": paymentID, "pending_refunds": refundID}
+	update := bson.M{
+		"$pull": bson.M{"pending_refunds": refundID},
+		"$set":  bson.M{"updated_at": now},
+	}
+	if !paid {
+		update["$inc"] = bson.M{"refunded_amount.amount": -amount.Amount}
+	}
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	if !paid {
+		return nil
+	}
+
+	// The payment is refunded once nothing is left and no refund is pending
+	_, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":               paymentID,
+		"status":            domain.PaymentStatusSuccess,
+		"pending_refunds.0": bson.M{"$exists": false},
+		"$expr":             bson.M{"$eq": bson.A{"$refunded_amount.amount", "$amount.amount"}},
+	}, bson.M{
+		"$set": bson.M{"status": domain.PaymentStatusRefunded, "updated_at": now},
+	})
+	return err
+}
+
+func (r *MongoPaymentRepository) FindUnsettled(ctx context.Context, limit int64) ([]domain.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, bson.M{"notified": false}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var payments []domain.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func (r *MongoPaymentRepository) findOne(ctx context.Context, filter bson.M) (*domain.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var payment domain.Payment
+	err := r.collection.FindOne(ctx, filter).Decode(&payment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
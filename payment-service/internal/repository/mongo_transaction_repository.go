@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"payment-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoTransactionRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoTransactionRepository(db *mongo.Database, timeout time.Duration) *MongoTransactionRepository {
+	return &MongoTransactionRepository{
+		collection: db.Collection("transactions"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes used by the payment history and
+// idempotent refunds.
+func (r *MongoTransactionRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "payment_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
+func (r *MongoTransactionRepository) Add(ctx context.Context, transaction *domain.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, transaction)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateIdempotencyKey
+	}
+	return err
+}
+
+func (r *MongoTransactionRepository) FindByPaymentID(ctx context.Context, paymentID string) ([]domain.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"payment_id": paymentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []domain.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (r *MongoTransactionRepository) FindByIdempotencyKey(ctx context.Context, key string) (*domain.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var transaction domain.Transaction
+	err := r.collection.FindOne(ctx, bson.M{"idempotency_key": key}).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (r *MongoTransactionRepository) Update(ctx context.Context, transaction *domain.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": transaction.ID}, transaction)
+	return err
+}
+
+func (r *MongoTransactionRepository) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *MongoTransactionRepository) ClaimRefund(ctx context.Context, id string, until time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":           id,
+		"type":          domain.TransactionTypeRefund,
+		"status":        domain.TransactionStatusPending,
+		"claimed_until": bson.M{"$lte": time.Now()},
+	}, bson.M{
+		"$set": bson.M{"claimed_until": until},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
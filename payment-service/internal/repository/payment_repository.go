@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"payment-service/internal/domain"
+	"shared/money"
+)
+
+// ErrDuplicateIdempotencyKey is returned when a payment or refund with the
+// same idempotency key already exists.
+var ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+
+type PaymentRepository interface {
+	Create(ctx context.Context, payment *domain.Payment) error
+	FindByID(ctx context.Context, id string) (*domain.Payment, error)
+	FindByIdempotencyKey(ctx context.Context, key string) (*domain.Payment, error)
+	Update(ctx context.Context, payment *domain.Payment) error
+	// MarkNotified records that the outcome of the payment was published.
+	MarkNotified(ctx context.Context, id string) error
+	// ReserveRefund adds amount to the refunded amount of a successful
+	// payment and marks the refund pending, unless that would refund more
+	// than was paid. It reports false when the payment cannot take the
+	// refund. Reserving a refund that is already pending changes nothing.
+	ReserveRefund(ctx context.Context, paymentID, refundID string, amount money.Money) (bool, error)
+	// CompleteRefund settles a pending refund: a refund the gateway paid
+	// stays counted and may complete the refund of the payment, any other
+	// gives its amount back. Completing a refund that is not pending
+	// changes nothing.
+	CompleteRefund(ctx context.Context, paymentID, refundID string, amount money.Money, paid bool) error
+	// FindUnsettled returns payments that are pending at the gateway or whose
+	// outcome has not been published yet.
+	FindUnsettled(ctx context.Context, limit int64) ([]domain.Payment, error)
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"payment-service/internal/domain"
+)
+
+type TransactionRepository interface {
+	Add(ctx context.Context, transaction *domain.Transaction) error
+	FindByPaymentID(ctx context.Context, paymentID string) ([]domain.Transaction, error)
+	FindByIdempotencyKey(ctx context.Context, key string) (*domain.Transaction, error)
+	Update(ctx context.Context, transaction *domain.Transaction) error
+	Delete(ctx context.Context, id string) error
+	// ClaimRefund takes over a pending refund whose claim ran out, claiming
+	// it until until. It reports false when another request holds it.
+	ClaimRefund(ctx context.Context, id string, until time.Time) (bool, error)
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-service/internal/domain"
+	"payment-service/internal/gateway"
+	"payment-service/internal/repository"
+	"payment-service/pkg/eventbus"
+	"shared/money"
+	"shared/signature"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPayment       = errors.New("invalid payment")
+	ErrPaymentNotFound      = errors.New("payment not found")
+	ErrInvalidRefund        = errors.New("invalid refund")
+	ErrRefundNotAllowed     = errors.New("payment cannot be refunded")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	ErrRefundInProgress     = errors.New("refund is already being processed")
+	ErrGatewayUnavailable   = errors.New("payment gateway unavailable")
+)
+
+// PaymentStatusTopic carries the signed outcome of payments.
+const PaymentStatusTopic = "payment.status_changed"
+
+const settlementBatch = 100
+
+type PaymentService struct {
+	paymentRepo        repository.PaymentRepository
+	transactionRepo    repository.TransactionRepository
+	gateway            gateway.Gateway
+	eventBus           eventbus.EventBus
+	notificationSecret []byte
+	timeout            time.Duration
+}
+
+func NewPaymentService(
+	paymentRepo repository.PaymentRepository,
+	transactionRepo repository.TransactionRepository,
+	gateway gateway.Gateway,
+	eventBus eventbus.EventBus,
+	notificationSecret []byte,
+	timeout time.Duration,
+) *PaymentService {
+	return &PaymentService{
+		paymentRepo:        paymentRepo,
+		transactionRepo:    transactionRepo,
+		gateway:            gateway,
+		eventBus:           eventBus,
+		notificationSecret: notificationSecret,
+		timeout:            timeout,
+	}
+}
+
+// CreatePayment charges the order through the gateway. Requests repeated with
+// the same idempotency key return the first payment without charging again.
+// A declined payment is returned with the failed status, not as an error.
+// Every outcome is also published; until it is, the settlement worker keeps
+// the payment, so a crash before the gateway answered is not lost.
+func (s *PaymentService) CreatePayment(ctx context.Context, orderID, userID, method string, amount money.Money, idempotencyKey string) (*domain.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	// Validate input
+	if orderID == "" || amount.Validate() != nil || amount.IsZero() || amount.IsNegative() {
+		return nil, ErrInvalidPayment
+	}
+
+	// Reserve the idempotency key with the payment before charging
+	now := time.Now()
+	payment := &domain.Payment{
+		ID:             uuid.New().String(),
+		OrderID:        orderID,
+		UserID:         userID,
+		Method:         method,
+		Amount:         amount,
+		RefundedAmount: money.Zero(amount.Currency),
+		Status:         domain.PaymentStatusPending,
+		Gateway:        s.gateway.Name(),
+		IdempotencyKey: idempotencyKey,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.paymentRepo.Create(ctx, payment); err != nil {
+		if errors.Is(err, repository.ErrDuplicateIdempotencyKey) {
+			return s.replayPayment(ctx, orderID, amount, idempotencyKey)
+		}
+		return nil, err
+	}
+
+	result, err := s.gateway.Charge(ctx, gateway.ChargeRequest{
+		PaymentID: payment.ID,
+		OrderID:   orderID,
+		Method:    method,
+		Amount:    amount,
+	})
+	if err != nil {
+		log.Printf("gateway %s failed to charge payment %s: %v", payment.Gateway, payment.ID, err)
+		result = &gateway.ChargeResult{
+			Status:  domain.PaymentStatusFailed,
+			Message: err.Error(),
+		}
+	}
+
+	payment.Status = result.Status
+	payment.GatewayRef = result.Reference
+	payment.PaymentURL = result.PaymentURL
+	if err := s.paymentRepo.Update(ctx, payment); err != nil {
+		return nil, err
+	}
+
+	s.recordTransaction(ctx, payment, domain.TransactionTypeCharge, toTransactionStatus(result.Status), amount, result.Reference, result.Message)
+
+	// Pending payments are notified once the gateway settles them, outcomes
+	// that could not be published are retried by the settlement worker
+	if result.Status.IsFinal() {
+		s.notifyPayment(ctx, payment)
+	}
+
+	return payment, nil
+}
+
+// ProcessRefund pays back part or all of a successful payment. The refund is
+// recorded pending under its idempotency key before the gateway is called, so
+// requests repeated with the same key pay it once: they return the outcome of
+// a finished refund or retry an unfinished one with the same refund ID. The
+// amount is reserved on the payment first, so concurrent refunds never pay
+// back more than was paid.
+func (s *PaymentService) ProcessRefund(ctx context.Context, paymentID, orderID string, amount money.Money, reason, idempotencyKey string) (*domain.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if amount.Validate() != nil || amount.IsZero() || amount.IsNegative() {
+		return nil, ErrInvalidRefund
+	}
+
+	payment, err := s.paymentRepo.FindByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil || (orderID != "" && payment.OrderID != orderID) {
+		return nil, ErrPaymentNotFound
+	}
+
+	transaction, err := s.claimRefund(ctx, payment, amount, reason, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if transaction.Status != domain.TransactionStatusPending {
+		// Finish the refund in case the request that paid it stopped early
+		paid := transaction.Status == domain.TransactionStatusSuccess
+		if err := s.paymentRepo.CompleteRefund(ctx, payment.ID, transaction.ID, transaction.Amount, paid); err != nil {
+			return nil, err
+		}
+		return transaction, nil
+	}
+
+	// Never refund more than is left of the payment
+	reserved, err := s.paymentRepo.ReserveRefund(ctx, payment.ID, transaction.ID, amount)
+	if err != nil {
+		s.releaseRefund(ctx, transaction)
+		return nil, err
+	}
+	if !reserved {
+		// Nothing was paid back, so the key may be used again
+		if err := s.transactionRepo.Delete(ctx, transaction.ID); err != nil {
+			log.Printf("failed to delete rejected refund %s of payment %s: %v", transaction.ID, payment.ID, err)
+		}
+		if payment.Status != domain.PaymentStatusSuccess {
+			return nil, ErrRefundNotAllowed
+		}
+		return nil, ErrInvalidRefund
+	}
+
+	result, err := s.gateway.Refund(ctx, gateway.RefundRequest{
+		PaymentID: payment.ID,
+		RefundID:  transaction.ID,
+		Reference: payment.GatewayRef,
+		Amount:    amount,
+		Reason:    reason,
+	})
+	if err != nil {
+		// The gateway may have paid the refund, so it stays pending and
+		// reserved until a retry learns the outcome
+		log.Printf("gateway %s failed to refund payment %s: %v", payment.Gateway, payment.ID, err)
+		s.releaseRefund(ctx, transaction)
+		return nil, fmt.Errorf("%w: %v", ErrGatewayUnavailable, err)
+	}
+
+	transaction.GatewayRef = result.Reference
+	if result.Status == domain.TransactionStatusPending {
+		s.releaseRefund(ctx, transaction)
+		return transaction, nil
+	}
+
+	transaction.Status = result.Status
+	transaction.ClaimedUntil = time.Time{}
+	if err := s.transactionRepo.Update(ctx, transaction); err != nil {
+		return nil, err
+	}
+	paid := result.Status == domain.TransactionStatusSuccess
+	if err := s.paymentRepo.CompleteRefund(ctx, payment.ID, transaction.ID, amount, paid); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// claimRefund records a pending refund under the idempotency key, or returns
+// the refund recorded earlier with it. A pending refund recorded earlier is
+// taken over once the request working on it gave up its claim.
+func (s *PaymentService) claimRefund(ctx context.Context, payment *domain.Payment, amount money.Money, reason, idempotencyKey string) (*domain.Transaction, error) {
+	now := time.Now()
+	transaction := &domain.Transaction{
+		ID:             uuid.New().String(),
+		PaymentID:      payment.ID,
+		OrderID:        payment.OrderID,
+		Type:           domain.TransactionTypeRefund,
+		Status:         domain.TransactionStatusPending,
+		Amount:         amount,
+		Message:        reason,
+		IdempotencyKey: idempotencyKey,
+		ClaimedUntil:   now.Add(s.timeout),
+		CreatedAt:      now,
+	}
+	err := s.transactionRepo.Add(ctx, transaction)
+	if err == nil {
+		return transaction, nil
+	}
+	if !errors.Is(err, repository.ErrDuplicateIdempotencyKey) {
+		return nil, err
+	}
+
+	existing, err := s.transactionRepo.FindByIdempotencyKey(ctx, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// The refund was rejected and deleted in the meantime
+		return nil, ErrRefundInProgress
+	}
+	if existing.PaymentID != payment.ID || existing.Amount != amount {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.Status != domain.TransactionStatusPending {
+		return existing, nil
+	}
+
+	until := time.Now().Add(s.timeout)
+	claimed, err := s.transactionRepo.ClaimRefund(ctx, existing.ID, until)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrRefundInProgress
+	}
+	existing.ClaimedUntil = until
+	return existing, nil
+}
+
+// releaseRefund gives up the claim on a pending refund so that a retry can
+// take it over right away. Otherwise the claim runs out on its own.
+func (s *PaymentService) releaseRefund(ctx context.Context, transaction *domain.Transaction) {
+	transaction.ClaimedUntil = time.Now()
+	if err := s.transactionRepo.Update(ctx, transaction); err != nil {
+		log.Printf("failed to release refund %s of payment %s: %v", transaction.ID, transaction.PaymentID, err)
+	}
+}
+
+// GetPaymentStatus returns the payment together with its transaction history.
+// Without a payment ID the payment is looked up by the idempotency key it was
+// created with.
+func (s *PaymentService) GetPaymentStatus(ctx context.Context, paymentID, idempotencyKey string) (*domain.Payment, []domain.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var payment *domain.Payment
+	var err error
+	switch {
+	case paymentID != "":
+		payment, err = s.paymentRepo.FindByID(ctx, paymentID)
+	case idempotencyKey != "":
+		payment, err = s.paymentRepo.FindByIdempotencyKey(ctx, idempotencyKey)
+	default:
+		return nil, nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if payment == nil {
+		return nil, nil, ErrPaymentNotFound
+	}
+
+	transactions, err := s.transactionRepo.FindByPaymentID(ctx, payment.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payment, transactions, nil
+}
+
+// RunSettlement polls the gateway for the outcome of pending payments and
+// publishes it every interval until ctx is done. Outcomes that could not be
+// published are retried on the next run.
+func (s *PaymentService) RunSettlement(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.settlePayments(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *PaymentService) settlePayments(ctx context.Context) {
+	payments, err := s.paymentRepo.FindUnsettled(ctx, settlementBatch)
+	if err != nil {
+		log.Printf("failed to find unsettled payments: %v", err)
+		return
+	}
+
+	for i := range payments {
+		payment := &payments[i]
+
+		if payment.Status == domain.PaymentStatusPending && payment.GatewayRef == "" {
+			// The charge of a payment without a reference never got an
+			// answer from the gateway. Once its request timed out nothing
+			// will charge it anymore, so it failed.
+			if time.Since(payment.CreatedAt) < s.timeout {
+				continue
+			}
+			payment.Status = domain.PaymentStatusFailed
+			if err := s.paymentRepo.Update(ctx, payment); err != nil {
+				log.Printf("failed to fail abandoned payment %s: %v", payment.ID, err)
+				continue
+			}
+			s.recordTransaction(ctx, payment, domain.TransactionTypeSettlement, domain.TransactionStatusFailed, payment.Amount, "", "charge was abandoned")
+		}
+
+		if payment.Status == domain.PaymentStatusPending {
+			result, err := s.gateway.Status(ctx, payment.GatewayRef)
+			if err != nil {
+				log.Printf("failed to get gateway status of payment %s: %v", payment.ID, err)
+				continue
+			}
+			if !result.Status.IsFinal() {
+				continue
+			}
+
+			payment.Status = result.Status
+			if err := s.paymentRepo.Update(ctx, payment); err != nil {
+				log.Printf("failed to settle payment %s: %v", payment.ID, err)
+				continue
+			}
+			s.recordTransaction(ctx, payment, domain.TransactionTypeSettlement, toTransactionStatus(result.Status), payment.Amount, result.Reference, result.Message)
+		}
+
+		s.notifyPayment(ctx, payment)
+	}
+}
+
+// notifyPayment publishes the outcome of a payment and marks it notified.
+// Outcomes that could not be published are retried on the next settlement.
+func (s *PaymentService) notifyPayment(ctx context.Context, payment *domain.Payment) {
+	if err := s.notify(payment); err != nil {
+		log.Printf("failed to publish outcome of payment %s: %v", payment.ID, err)
+		return
+	}
+	payment.Notified = true
+	if err := s.paymentRepo.MarkNotified(ctx, payment.ID); err != nil {
+		log.Printf("failed to mark payment %s notified: %v", payment.ID, err)
+	}
+}
+
+// notify publishes the signed outcome of a payment for the order service.
+func (s *PaymentService) notify(payment *domain.Payment) error {
+	notification := domain.PaymentNotification{
+		PaymentID:  payment.ID,
+		OrderID:    payment.OrderID,
+		Status:     string(payment.Status),
+		Amount:     payment.Amount,
+		OccurredAt: payment.UpdatedAt,
+	}
+	notification.Signature = signature.Sign(s.notificationSecret, notification.SignedPayload())
+
+	return s.eventBus.Publish(PaymentStatusTopic, notification)
+}
+
+// recordTransaction appends to the payment history. The payment itself is
+// already saved, so a failure is only logged.
+func (s *PaymentService) recordTransaction(ctx context.Context, payment *domain.Payment, txType domain.TransactionType, status domain.TransactionStatus, amount money.Money, reference, message string) {
+	transaction := &domain.Transaction{
+		ID:         uuid.New().String(),
+		PaymentID:  payment.ID,
+		OrderID:    payment.OrderID,
+		Type:       txType,
+		Status:     status,
+		Amount:     amount,
+		GatewayRef: reference,
+		Message:    message,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.transactionRepo.Add(ctx, transaction); err != nil {
+		log.Printf("failed to record %s transaction of payment %s: %v", txType, payment.ID, err)
+	}
+}
+
+// replayPayment returns the payment created earlier with the idempotency key.
+func (s *PaymentService) replayPayment(ctx context.Context, orderID string, amount money.Money, idempotencyKey string) (*domain.Payment, error) {
+	payment, err := s.paymentRepo.FindByIdempotencyKey(ctx, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.OrderID != orderID || payment.Amount != amount {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return payment, nil
+}
+
+func toTransactionStatus(status domain.PaymentStatus) domain.TransactionStatus {
+	switch status {
+	case domain.PaymentStatusSuccess:
+		return domain.TransactionStatusSuccess
+	case domain.PaymentStatusPending:
+		return domain.TransactionStatusPending
+	default:
+		return domain.TransactionStatusFailed
+	}
+}
@@ -0,0 +1,6 @@
+package eventbus
+
+type EventBus interface {
+	Publish(topic string, event interface{}) error
+	Close() error
+}
@@ -19,6 +19,8 @@ import (
 	"product-service/internal/repository"
 	"product-service/internal/service"
 	"product-service/pkg/grpcutil"
+	"shared/auth"
+	"shared/jwt"
 )
 
 func main() {
@@ -44,17 +46,32 @@ func main() {
 
 	// Initialize Repository
 	productRepo := repository.NewMongoProductRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	reservationRepo := repository.NewMongoReservationRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	if err := reservationRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create reservation indexes: %v", err)
+	}
+	transactor := repository.NewMongoTransactor(mongoClient)
 
 	// Initialize Services
 	productService := service.NewProductService(productRepo, 5*time.Second)
+	reservationService := service.NewReservationService(productRepo, reservationRepo, transactor, cfg.ReservationTTL, cfg.ReservationMaxTTL, 5*time.Second)
+
+	// Release reservations of abandoned checkouts
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go reservationService.RunExpirySweeper(sweeperCtx, cfg.ReservationSweepInterval)
 
 	// Initialize gRPC Server
+	// Tokens are only verified here, so the token duration is unused
+	jwtManager := jwt.NewManager(cfg.JWTSecret, time.Hour)
+	serviceJWTManager := jwt.NewManager(cfg.ServiceJWTSecret, time.Hour)
+	authInterceptor := auth.NewInterceptor(jwtManager, serviceJWTManager, handler.MethodAccess)
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(grpcutil.LoggingInterceptor),
+		grpc.ChainUnaryInterceptor(grpcutil.LoggingInterceptor, handler.ErrorInterceptor, authInterceptor.Unary),
 	)
 
 	// Register Services
-	productHandler := handler.NewProductGRPCHandler(productService)
+	productHandler := handler.NewProductGRPCHandler(productService, reservationService)
 	product.RegisterProductServiceServer(grpcServer, productHandler)
 	reflection.Register(grpcServer)
 
@@ -1,16 +1,26 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	GRPCPort string
-	MongoURI string
-	MongoDB  string
+	GRPCPort                 string
+	MongoURI                 string
+	MongoDB                  string
+	ReservationTTL           time.Duration
+	ReservationMaxTTL        time.Duration
+	ReservationSweepInterval time.Duration
+	// JWTSecret verifies the access tokens issued by user-service.
+	JWTSecret string
+	// ServiceJWTSecret verifies the calls of the other services. It must
+	// differ from JWTSecret.
+	ServiceJWTSecret string
 }
 
 func Load() (*Config, error) {
@@ -18,10 +28,28 @@ func Load() (*Config, error) {
 		log.Println("no .env file found")
 	}
 
+	jwtSecret := getEnv("JWT_SECRET", "")
+	if jwtSecret == "" {
+		return nil, errors.New("JWT_SECRET is required")
+	}
+
+	serviceJWTSecret := getEnv("SERVICE_JWT_SECRET", "")
+	if serviceJWTSecret == "" {
+		return nil, errors.New("SERVICE_JWT_SECRET is required")
+	}
+	if serviceJWTSecret == jwtSecret {
+		return nil, errors.New("SERVICE_JWT_SECRET must differ from JWT_SECRET")
+	}
+
 	return &Config{
-		GRPCPort: getEnv("GRPC_PORT", "50051"),
-		MongoURI: getEnv("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDB:  getEnv("MONGO_DB", "product_service"),
+		GRPCPort:                 getEnv("GRPC_PORT", "50051"),
+		MongoURI:                 getEnv("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:                  getEnv("MONGO_DB", "product_service"),
+		ReservationTTL:           getEnvAsDuration("RESERVATION_TTL", 15*time.Minute),
+		ReservationMaxTTL:        getEnvAsDuration("RESERVATION_MAX_TTL", time.Hour),
+		ReservationSweepInterval: getEnvAsDuration("RESERVATION_SWEEP_INTERVAL", time.Minute),
+		JWTSecret:                jwtSecret,
+		ServiceJWTSecret:         serviceJWTSecret,
 	}, nil
 }
 
@@ -31,3 +59,13 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("invalid duration for %s, using default %s", key, defaultValue)
+	}
+	return defaultValue
+}
@@ -2,22 +2,28 @@ package domain
 
 import (
 	"time"
+
+	"shared/money"
 )
 
 type Product struct {
-	ID          string    `json:"id" bson:"_id"`
-	Name        string    `json:"name" bson:"name"`
-	Description string    `json:"description" bson:"description"`
-	Price       float64   `json:"price" bson:"price"`
-	Stock       int       `json:"stock" bson:"stock"`
-	Category    string    `json:"category" bson:"category"`
-	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+	ID          string      `json:"id" bson:"_id"`
+	Name        string      `json:"name" bson:"name"`
+	Description string      `json:"description" bson:"description"`
+	Price       money.Money `json:"price" bson:"price"`
+	Stock       int         `json:"stock" bson:"stock"`
+	Category    string      `json:"category" bson:"category"`
+	TaxCategory string      `json:"tax_category,omitempty" bson:"tax_category,omitempty"`
+	WeightGrams int         `json:"weight_grams,omitempty" bson:"weight_grams,omitempty"`
+	SellerID    string      `json:"seller_id,omitempty" bson:"seller_id,omitempty"`
+	CreatedAt   time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" bson:"updated_at"`
 }
 
 type ProductStock struct {
-	ID    string `json:"id" bson:"_id"`
-	Stock int    `json:"stock" bson:"stock"`
+	ID       string `json:"id" bson:"_id"`
+	Stock    int    `json:"stock" bson:"stock"`
+	Quantity int    `json:"quantity" bson:"-"`
 }
 
 type ProductValidation struct {
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationStatusActive    ReservationStatus = "active"
+	ReservationStatusCommitted ReservationStatus = "committed"
+	ReservationStatusReleased  ReservationStatus = "released"
+	ReservationStatusExpired   ReservationStatus = "expired"
+)
+
+// Reservation holds stock for an order until it is committed on payment or
+// released. Reserved quantities are taken out of the product stock up front
+// and returned when the reservation is released or expires.
+type Reservation struct {
+	ID        string            `json:"id" bson:"_id"`
+	OrderID   string            `json:"order_id" bson:"order_id"`
+	Items     []ReservedItem    `json:"items" bson:"items"`
+	Status    ReservationStatus `json:"status" bson:"status"`
+	ExpiresAt time.Time         `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at" bson:"updated_at"`
+}
+
+type ReservedItem struct {
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+}
@@ -0,0 +1,12 @@
+package handler
+
+import "shared/auth"
+
+// MethodAccess keeps the stock and reservation writes to admins and the
+// services that check out orders. Any signed-in user may read the catalog.
+var MethodAccess = map[string]auth.Access{
+	"/product.ProductService/UpdateStock":        auth.AccessService,
+	"/product.ProductService/ReserveStock":       auth.AccessService,
+	"/product.ProductService/CommitReservation":  auth.AccessService,
+	"/product.ProductService/ReleaseReservation": auth.AccessService,
+}
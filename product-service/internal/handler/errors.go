@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"product-service/internal/service"
+	"shared/auth"
+	"shared/money"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain identifies this service in google.rpc.ErrorInfo details.
+const errorDomain = "product-service"
+
+type errorMapping struct {
+	err    error
+	code   codes.Code
+	reason string
+}
+
+var errorMappings = []errorMapping{
+	{service.ErrProductNotFound, codes.NotFound, "PRODUCT_NOT_FOUND"},
+	{service.ErrReservationNotFound, codes.NotFound, "RESERVATION_NOT_FOUND"},
+	{service.ErrInvalidStock, codes.InvalidArgument, "INVALID_STOCK"},
+	{service.ErrInvalidReservationTTL, codes.InvalidArgument, "INVALID_RESERVATION_TTL"},
+	{money.ErrUnsupportedCurrency, codes.InvalidArgument, "UNSUPPORTED_CURRENCY"},
+	{auth.ErrUnauthenticated, codes.Unauthenticated, "UNAUTHENTICATED"},
+	{auth.ErrPermissionDenied, codes.PermissionDenied, "PERMISSION_DENIED"},
+	{service.ErrInsufficientStock, codes.FailedPrecondition, "INSUFFICIENT_STOCK"},
+	{service.ErrReservationNotActive, codes.FailedPrecondition, "RESERVATION_NOT_ACTIVE"},
+}
+
+// ErrorInterceptor turns the errors returned by the handlers into gRPC
+// statuses with google.rpc error details.
+func ErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return resp, nil
+}
+
+func toStatusError(err error) error {
+	for _, m := range errorMappings {
+		if !errors.Is(err, m.err) {
+			continue
+		}
+
+		details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: m.reason, Domain: errorDomain}}
+		var stockErr *service.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			failure := &errdetails.PreconditionFailure{}
+			for _, id := range stockErr.ProductIDs {
+				failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+					Type:        "STOCK",
+					Subject:     id,
+					Description: "insufficient stock",
+				})
+			}
+			details = append(details, failure)
+		}
+
+		st := status.New(m.code, err.Error())
+		if withDetails, detailsErr := st.WithDetails(details...); detailsErr == nil {
+			st = withDetails
+		}
+		return st.Err()
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -3,20 +3,25 @@ package handler
 import (
 	"context"
 	"log"
+	"time"
 
 	"product-service/gen/product"
 	"product-service/internal/domain"
 	"product-service/internal/service"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type ProductGRPCHandler struct {
 	product.UnimplementedProductServiceServer
-	service *service.ProductService
+	service            *service.ProductService
+	reservationService *service.ReservationService
 }
 
-func NewProductGRPCHandler(svc *service.ProductService) *ProductGRPCHandler {
+func NewProductGRPCHandler(svc *service.ProductService, reservationSvc *service.ReservationService) *ProductGRPCHandler {
 	return &ProductGRPCHandler{
-		service: svc,
+		service:            svc,
+		reservationService: reservationSvc,
 	}
 }
 
@@ -25,8 +30,8 @@ func (h *ProductGRPCHandler) ValidateProducts(ctx context.Context, req *product.
 	var items []domain.ProductStock
 	for _, item := range req.Items {
 		items = append(items, domain.ProductStock{
-			ID:    item.ProductId,
-			Stock: int(item.Quantity),
+			ID:       item.ProductId,
+			Quantity: int(item.Quantity),
 		})
 	}
 
@@ -68,10 +73,91 @@ func (h *ProductGRPCHandler) GetProductDetails(ctx context.Context, req *product
 			Id:          p.ID,
 			Name:        p.Name,
 			Description: p.Description,
-			Price:       p.Price,
 			Stock:       int32(p.Stock),
+			Price: &product.Money{
+				Amount:   p.Price.Amount,
+				Currency: string(p.Price.Currency),
+			},
+			TaxCategory: p.TaxCategory,
+			WeightGrams: int32(p.WeightGrams),
+			SellerId:    p.SellerID,
 		})
 	}
 
 	return resp, nil
 }
+
+func (h *ProductGRPCHandler) UpdateStock(ctx context.Context, req *product.UpdateStockRequest) (*product.UpdateStockResponse, error) {
+	// Convert request to domain objects
+	var items []domain.ProductStock
+	for _, item := range req.Items {
+		items = append(items, domain.ProductStock{
+			ID:       item.ProductId,
+			Quantity: int(item.Quantity),
+		})
+	}
+
+	// Call service
+	var err error
+	if req.Operation == product.StockOperation_STOCK_OPERATION_INCREASE {
+		err = h.service.RestockProducts(ctx, items)
+	} else {
+		err = h.service.UpdateProductStocks(ctx, items)
+	}
+	if err != nil {
+		log.Printf("UpdateStock failed: %v", err)
+		return nil, err
+	}
+
+	return &product.UpdateStockResponse{Success: true}, nil
+}
+
+func (h *ProductGRPCHandler) ReserveStock(ctx context.Context, req *product.ReserveStockRequest) (*product.ReservationResponse, error) {
+	// Convert request to domain objects
+	var items []domain.ProductStock
+	for _, item := range req.Items {
+		items = append(items, domain.ProductStock{
+			ID:       item.ProductId,
+			Quantity: int(item.Quantity),
+		})
+	}
+
+	// Call service
+	reservation, err := h.reservationService.ReserveStock(ctx, req.OrderId, items, time.Duration(req.TtlSeconds)*time.Second)
+	if err != nil {
+		log.Printf("ReserveStock failed: %v", err)
+		return nil, err
+	}
+
+	return toReservationResponse(reservation), nil
+}
+
+func (h *ProductGRPCHandler) CommitReservation(ctx context.Context, req *product.ReservationRequest) (*product.ReservationResponse, error) {
+	// Call service
+	reservation, err := h.reservationService.CommitReservation(ctx, req.ReservationId)
+	if err != nil {
+		log.Printf("CommitReservation failed: %v", err)
+		return nil, err
+	}
+
+	return toReservationResponse(reservation), nil
+}
+
+func (h *ProductGRPCHandler) ReleaseReservation(ctx context.Context, req *product.ReservationRequest) (*product.ReservationResponse, error) {
+	// Call service
+	reservation, err := h.reservationService.ReleaseReservation(ctx, req.ReservationId)
+	if err != nil {
+		log.Printf("ReleaseReservation failed: %v", err)
+		return nil, err
+	}
+
+	return toReservationResponse(reservation), nil
+}
+
+func toReservationResponse(reservation *domain.Reservation) *product.ReservationResponse {
+	return &product.ReservationResponse{
+		ReservationId: reservation.ID,
+		Status:        string(reservation.Status),
+		ExpiresAt:     timestamppb.New(reservation.ExpiresAt),
+	}
+}
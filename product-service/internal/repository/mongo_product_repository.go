@@ -116,3 +116,43 @@ func (r *MongoProductRepository) UpdateStocks(ctx context.Context, items []domai
 	_, err := r.collection.BulkWrite(ctx, operations)
 	return err
 }
+
+func (r *MongoProductRepository) RestockStocks(ctx context.Context, items []domain.ProductStock) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var operations []mongo.WriteModel
+	for _, item := range items {
+		update := bson.M{
+			"$inc": bson.M{"stock": item.Quantity},
+			"$set": bson.M{"updated_at": time.Now()},
+		}
+		operation := mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": item.ID}).
+			SetUpdate(update)
+		operations = append(operations, operation)
+	}
+
+	_, err := r.collection.BulkWrite(ctx, operations)
+	return err
+}
+
+func (r *MongoProductRepository) DecreaseStockIfAvailable(ctx context.Context, id string, quantity int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":   id,
+		"stock": bson.M{"$gte": quantity},
+	}
+	update := bson.M{
+		"$inc": bson.M{"stock": -quantity},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"product-service/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoReservationRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func NewMongoReservationRepository(db *mongo.Database, timeout time.Duration) *MongoReservationRepository {
+	return &MongoReservationRepository{
+		collection: db.Collection("reservations"),
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes used by the order lookup and the expiry
+// sweep. An order can have only one active reservation.
+func (r *MongoReservationRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "status", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": domain.ReservationStatusActive}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoReservationRepository) Create(ctx context.Context, reservation *domain.Reservation) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, reservation)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrActiveReservationExists
+	}
+	return err
+}
+
+func (r *MongoReservationRepository) FindByID(ctx context.Context, id string) (*domain.Reservation, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoReservationRepository) FindActiveByOrderID(ctx context.Context, orderID string) (*domain.Reservation, error) {
+	return r.findOne(ctx, bson.M{
+		"order_id": orderID,
+		"status":   domain.ReservationStatusActive,
+	})
+}
+
+func (r *MongoReservationRepository) FindExpired(ctx context.Context, now time.Time, limit int64) ([]domain.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"status":     domain.ReservationStatusActive,
+		"expires_at": bson.M{"$lte": now},
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reservations []domain.Reservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+func (r *MongoReservationRepository) Extend(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":        id,
+		"status":     domain.ReservationStatusActive,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$max": bson.M{"expires_at": expiresAt},
+		"$set": bson.M{"updated_at": now},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func (r *MongoReservationRepository) Transition(ctx context.Context, id string, from, to domain.ReservationStatus) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "status": from}
+	if from == domain.ReservationStatusActive && to == domain.ReservationStatusCommitted {
+		// Expired reservations have already lost their stock
+		filter["expires_at"] = bson.M{"$gt": time.Now()}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     to,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *MongoReservationRepository) findOne(ctx context.Context, filter bson.M) (*domain.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var reservation domain.Reservation
+	err := r.collection.FindOne(ctx, filter).Decode(&reservation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &reservation, nil
+}
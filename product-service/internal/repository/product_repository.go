@@ -10,4 +10,8 @@ type ProductRepository interface {
 	FindMultipleByID(ctx context.Context, ids []string) ([]domain.Product, error)
 	CheckStocks(ctx context.Context, items []domain.ProductStock) (domain.ProductValidation, error)
 	UpdateStocks(ctx context.Context, items []domain.ProductStock) error
+	RestockStocks(ctx context.Context, items []domain.ProductStock) error
+	// DecreaseStockIfAvailable takes quantity out of a product's stock only
+	// when enough is left, reporting whether it did.
+	DecreaseStockIfAvailable(ctx context.Context, id string, quantity int) (bool, error)
 }
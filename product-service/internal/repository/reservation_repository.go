@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"product-service/internal/domain"
+)
+
+// ErrActiveReservationExists is returned by Create when the order already has
+// an active reservation.
+var ErrActiveReservationExists = errors.New("order already has an active reservation")
+
+type ReservationRepository interface {
+	Create(ctx context.Context, reservation *domain.Reservation) error
+	FindByID(ctx context.Context, id string) (*domain.Reservation, error)
+	FindActiveByOrderID(ctx context.Context, orderID string) (*domain.Reservation, error)
+	FindExpired(ctx context.Context, now time.Time, limit int64) ([]domain.Reservation, error)
+	// Extend moves the expiry of an active reservation that has not expired
+	// yet to expiresAt, if that is later. It returns false when the
+	// reservation is no longer active or has expired.
+	Extend(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+	// Transition moves a reservation from one status to another and returns
+	// false when the reservation is not in the expected status.
+	Transition(ctx context.Context, id string, from, to domain.ReservationStatus) (bool, error)
+}
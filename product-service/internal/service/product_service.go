@@ -57,12 +57,30 @@ func (s *ProductService) UpdateProductStocks(ctx context.Context, items []domain
 		return err
 	}
 	if !validation.Valid {
-		return ErrInvalidStock
+		stockErr := &InsufficientStockError{}
+		for _, item := range validation.UnavailableItems {
+			stockErr.ProductIDs = append(stockErr.ProductIDs, item.ID)
+		}
+		return stockErr
 	}
 
 	return s.repo.UpdateStocks(ctx, items)
 }
 
+func (s *ProductService) RestockProducts(ctx context.Context, items []domain.ProductStock) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	// Validate input
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return ErrInvalidStock
+		}
+	}
+
+	return s.repo.RestockStocks(ctx, items)
+}
+
 func (s *ProductService) GetProduct(ctx context.Context, id string) (*domain.Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"product-service/internal/domain"
+	"product-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInsufficientStock     = errors.New("insufficient stock")
+	ErrReservationNotFound   = errors.New("reservation not found")
+	ErrReservationNotActive  = errors.New("reservation is no longer active")
+	ErrInvalidReservationTTL = errors.New("invalid reservation ttl")
+)
+
+const expirySweepBatch = 100
+
+// InsufficientStockError lists the products that do not have enough stock.
+// It matches ErrInsufficientStock with errors.Is.
+type InsufficientStockError struct {
+	ProductIDs []string
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInsufficientStock, strings.Join(e.ProductIDs, ", "))
+}
+
+func (e *InsufficientStockError) Unwrap() error {
+	return ErrInsufficientStock
+}
+
+type ReservationService struct {
+	productRepo     repository.ProductRepository
+	reservationRepo repository.ReservationRepository
+	transactor      repository.Transactor
+	defaultTTL      time.Duration
+	maxTTL          time.Duration
+	timeout         time.Duration
+}
+
+func NewReservationService(
+	productRepo repository.ProductRepository,
+	reservationRepo repository.ReservationRepository,
+	transactor repository.Transactor,
+	defaultTTL time.Duration,
+	maxTTL time.Duration,
+	timeout time.Duration,
+) *ReservationService {
+	return &ReservationService{
+		productRepo:     productRepo,
+		reservationRepo: reservationRepo,
+		transactor:      transactor,
+		defaultTTL:      defaultTTL,
+		maxTTL:          maxTTL,
+		timeout:         timeout,
+	}
+}
+
+// ReserveStock takes the items out of stock for the order until the
+// reservation is committed, released or expires. Reserving again for an order
+// with an active reservation returns the existing reservation, kept for at
+// least another ttl. A reservation that ran out is replaced by a new one.
+func (s *ReservationService) ReserveStock(ctx context.Context, orderID string, items []domain.ProductStock, ttl time.Duration) (*domain.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	// Validate input
+	if orderID == "" || len(items) == 0 {
+		return nil, ErrInvalidStock
+	}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidStock
+		}
+	}
+	if ttl < 0 || ttl > s.maxTTL {
+		return nil, ErrInvalidReservationTTL
+	}
+	if ttl == 0 {
+		ttl = s.defaultTTL
+	}
+
+	existing, err := s.reservationRepo.FindActiveByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		expiresAt := time.Now().Add(ttl)
+		extended, err := s.reservationRepo.Extend(ctx, existing.ID, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if extended {
+			if expiresAt.After(existing.ExpiresAt) {
+				existing.ExpiresAt = expiresAt
+			}
+			return existing, nil
+		}
+
+		// The reservation ran out before the sweeper got to it
+		if err := s.finish(ctx, existing, domain.ReservationStatusExpired); err != nil && !errors.Is(err, ErrReservationNotActive) {
+			return nil, err
+		}
+	}
+
+	// Take each item out of stock, putting back what was taken if any item
+	// runs short
+	var reserved []domain.ProductStock
+	for _, item := range items {
+		ok, err := s.productRepo.DecreaseStockIfAvailable(ctx, item.ID, item.Quantity)
+		if err == nil && !ok {
+			err = &InsufficientStockError{ProductIDs: []string{item.ID}}
+		}
+		if err != nil {
+			s.restock(ctx, reserved)
+			return nil, err
+		}
+		reserved = append(reserved, item)
+	}
+
+	now := time.Now()
+	reservation := &domain.Reservation{
+		ID:        uuid.New().String(),
+		OrderID:   orderID,
+		Status:    domain.ReservationStatusActive,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, item := range items {
+		reservation.Items = append(reservation.Items, domain.ReservedItem{
+			ProductID: item.ID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	if err := s.reservationRepo.Create(ctx, reservation); err != nil {
+		s.restock(ctx, reserved)
+		if errors.Is(err, repository.ErrActiveReservationExists) {
+			// A concurrent call reserved for the order first
+			existing, err := s.reservationRepo.FindActiveByOrderID(ctx, orderID)
+			if err == nil && existing == nil {
+				err = ErrReservationNotActive
+			}
+			if err != nil {
+				return nil, err
+			}
+			return existing, nil
+		}
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// CommitReservation makes the reserved stock permanent. Committing twice is a
+// no-op.
+func (s *ReservationService) CommitReservation(ctx context.Context, id string) (*domain.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	reservation, err := s.findReservation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status == domain.ReservationStatusCommitted {
+		return reservation, nil
+	}
+
+	ok, err := s.reservationRepo.Transition(ctx, id, domain.ReservationStatusActive, domain.ReservationStatusCommitted)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrReservationNotActive
+	}
+
+	reservation.Status = domain.ReservationStatusCommitted
+	return reservation, nil
+}
+
+// ReleaseReservation returns the reserved stock. Releasing a reservation that
+// was already released or has expired is a no-op.
+func (s *ReservationService) ReleaseReservation(ctx context.Context, id string) (*domain.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	reservation, err := s.findReservation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch reservation.Status {
+	case domain.ReservationStatusReleased, domain.ReservationStatusExpired:
+		return reservation, nil
+	case domain.ReservationStatusCommitted:
+		return nil, ErrReservationNotActive
+	}
+
+	if err := s.finish(ctx, reservation, domain.ReservationStatusReleased); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// ReleaseExpired returns the stock of active reservations past their expiry.
+func (s *ReservationService) ReleaseExpired(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	reservations, err := s.reservationRepo.FindExpired(ctx, time.Now(), expirySweepBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range reservations {
+		if err := s.finish(ctx, &reservations[i], domain.ReservationStatusExpired); err != nil {
+			log.Printf("failed to expire reservation %s: %v", reservations[i].ID, err)
+			continue
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+// RunExpirySweeper releases expired reservations every interval until ctx is done.
+func (s *ReservationService) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := s.ReleaseExpired(ctx)
+			if err != nil {
+				log.Printf("failed to release expired reservations: %v", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("released %d expired reservations", released)
+			}
+		}
+	}
+}
+
+// finish moves an active reservation to a final status and returns its stock.
+// Only the caller that wins the status change puts the stock back. Both
+// happen in one transaction: a failed restock leaves the reservation active,
+// so the release or the expiry sweeper tries again.
+func (s *ReservationService) finish(ctx context.Context, reservation *domain.Reservation, status domain.ReservationStatus) error {
+	var items []domain.ProductStock
+	for _, item := range reservation.Items {
+		items = append(items, domain.ProductStock{
+			ID:       item.ProductID,
+			Quantity: item.Quantity,
+		})
+	}
+
+	err := s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		ok, err := s.reservationRepo.Transition(ctx, reservation.ID, domain.ReservationStatusActive, status)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrReservationNotActive
+		}
+		return s.productRepo.RestockStocks(ctx, items)
+	})
+	if err != nil {
+		return err
+	}
+
+	reservation.Status = status
+	return nil
+}
+
+func (s *ReservationService) findReservation(ctx context.Context, id string) (*domain.Reservation, error) {
+	reservation, err := s.reservationRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reservation == nil {
+		return nil, ErrReservationNotFound
+	}
+	return reservation, nil
+}
+
+func (s *ReservationService) restock(ctx context.Context, items []domain.ProductStock) {
+	if len(items) == 0 {
+		return
+	}
+	if err := s.productRepo.RestockStocks(ctx, items); err != nil {
+		log.Printf("failed to restock after aborted reservation: %v", err)
+	}
+}
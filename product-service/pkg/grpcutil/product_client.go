@@ -54,3 +54,42 @@ func (c *ProductClient) GetProductDetails(ctx context.Context, productIDs []stri
 		ProductIds: productIDs,
 	})
 }
+
+func (c *ProductClient) UpdateStock(ctx context.Context, items []*product.ProductItem, operation product.StockOperation) (*product.UpdateStockResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.UpdateStock(ctx, &product.UpdateStockRequest{
+		Items:     items,
+		Operation: operation,
+	})
+}
+
+func (c *ProductClient) ReserveStock(ctx context.Context, orderID string, items []*product.ProductItem, ttl time.Duration) (*product.ReservationResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.ReserveStock(ctx, &product.ReserveStockRequest{
+		OrderId:    orderID,
+		Items:      items,
+		TtlSeconds: int32(ttl / time.Second),
+	})
+}
+
+func (c *ProductClient) CommitReservation(ctx context.Context, reservationID string) (*product.ReservationResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.CommitReservation(ctx, &product.ReservationRequest{
+		ReservationId: reservationID,
+	})
+}
+
+func (c *ProductClient) ReleaseReservation(ctx context.Context, reservationID string) (*product.ReservationResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.client.ReleaseReservation(ctx, &product.ReservationRequest{
+		ReservationId: reservationID,
+	})
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"shared/jwt"
+)
+
+// Roles carried by the access tokens of user-service.
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+	RoleSeller   = "seller"
+	// RoleService is held by the tokens services sign for their own calls.
+	RoleService = "service"
+)
+
+type (
+	claimsKey   struct{}
+	internalKey struct{}
+)
+
+// NewContext returns a copy of ctx carrying the claims of the caller.
+func NewContext(ctx context.Context, claims *jwt.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims of the caller, if the request carried a
+// valid access token.
+func FromContext(ctx context.Context) (*jwt.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*jwt.Claims)
+	return claims, ok && claims != nil
+}
+
+// NewInternalContext returns a copy of ctx marking calls made by the service
+// itself, such as its workers, with actor naming the worker. Only code in the
+// process can mark a context, a request never carries the mark.
+func NewInternalContext(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, internalKey{}, actor)
+}
+
+// InternalActor returns the worker that made the call, if ctx was marked by
+// NewInternalContext.
+func InternalActor(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(internalKey{}).(string)
+	return actor, ok
+}
+
+// HasRole reports whether the claims grant any of roles.
+func HasRole(claims *jwt.Claims, roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(claims.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivileged reports whether the claims may act for any user, which only
+// admins may. Services are limited to the methods granted AccessService.
+func IsPrivileged(claims *jwt.Claims) bool {
+	return HasRole(claims, RoleAdmin)
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"shared/jwt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("missing or invalid access token")
+	ErrPermissionDenied = errors.New("caller is not allowed to call this method")
+)
+
+// authorizationHeader carries "Bearer <token>" as gRPC metadata.
+const authorizationHeader = "authorization"
+
+// Access is who may call a method.
+type Access int
+
+const (
+	// AccessUser needs a valid access token of any role. It is the default.
+	AccessUser Access = iota
+	// AccessPublic needs no token. A token that is sent must still be valid.
+	AccessPublic
+	// AccessAdmin needs a token with the admin role.
+	AccessAdmin
+	// AccessService needs a token with the service or admin role, for the
+	// methods other services call.
+	AccessService
+)
+
+// Interceptor verifies the access tokens of incoming calls and puts their
+// claims in the context of the handlers.
+type Interceptor struct {
+	users    *jwt.Manager
+	services *jwt.Manager
+	methods  map[string]Access
+}
+
+// NewInterceptor returns an Interceptor granting access to full method names,
+// e.g. "/order.OrderService/CreatePromotion", as listed in methods. Methods
+// that are not listed need AccessUser. Tokens of users are verified with
+// users, the tokens other services sign with ServiceCredentials with services.
+func NewInterceptor(users, services *jwt.Manager, methods map[string]Access) *Interceptor {
+	return &Interceptor{
+		users:    users,
+		services: services,
+		methods:  methods,
+	}
+}
+
+// Unary authenticates unary calls.
+func (i *Interceptor) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := i.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Stream authenticates streaming calls.
+func (i *Interceptor) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (i *Interceptor) authenticate(ctx context.Context, method string) (context.Context, error) {
+	access := i.methods[method]
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		if access == AccessPublic {
+			return ctx, nil
+		}
+		return nil, ErrUnauthenticated
+	}
+	claims, err := i.verify(token)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	switch {
+	case access == AccessAdmin && !HasRole(claims, RoleAdmin):
+		return nil, ErrPermissionDenied
+	case access == AccessService && !HasRole(claims, RoleAdmin, RoleService):
+		return nil, ErrPermissionDenied
+	}
+	return NewContext(ctx, claims), nil
+}
+
+// verify accepts the service role only from tokens signed with the service
+// key, so that a leaked user secret cannot mint service tokens.
+func (i *Interceptor) verify(token string) (*jwt.Claims, error) {
+	if claims, err := i.services.Verify(token); err == nil {
+		if !HasRole(claims, RoleService) {
+			return nil, ErrUnauthenticated
+		}
+		return claims, nil
+	}
+
+	claims, err := i.users.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if HasRole(claims, RoleService) {
+		return nil, ErrUnauthenticated
+	}
+	return claims, nil
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	return token, ok && token != ""
+}
+
+// authenticatedStream hands the context with the claims to stream handlers.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,153 @@
+// Package money represents amounts as integers in the minor unit of their
+// currency, so that sums and comparisons are exact.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+)
+
+type Currency string
+
+const (
+	USD Currency = "USD"
+	IDR Currency = "IDR"
+)
+
+// minorUnitDigits is the number of decimal digits of each supported currency.
+// IDR is kept in whole rupiah: ISO 4217 lists two digits but sen are not in
+// circulation and payment gateways reject fractional rupiah.
+var minorUnitDigits = map[Currency]int{
+	USD: 2,
+	IDR: 0,
+}
+
+func ParseCurrency(code string) (Currency, error) {
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if _, ok := minorUnitDigits[currency]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCurrency, code)
+	}
+	return currency, nil
+}
+
+// MinorUnitDigits returns the number of decimal digits of the currency.
+func (c Currency) MinorUnitDigits() int {
+	return minorUnitDigits[c]
+}
+
+// Money is an amount in the minor unit of its currency, e.g. cents for USD.
+type Money struct {
+	Amount   int64    `json:"amount" bson:"amount"`
+	Currency Currency `json:"currency" bson:"currency"`
+}
+
+func New(amount int64, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func Zero(currency Currency) Money {
+	return Money{Currency: currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Validate checks that the currency is supported.
+func (m Money) Validate() error {
+	_, err := ParseCurrency(string(m.Currency))
+	return err
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul multiplies by a whole quantity, which never needs rounding.
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// MulRatio multiplies by num/den and rounds half away from zero to the minor
+// unit. It is used for percentages and rates, e.g. MulRatio(11, 100) for 11%.
+func (m Money) MulRatio(num, den int64) Money {
+	return Money{Amount: divRound(m.Amount*num, den), Currency: m.Currency}
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or 1.
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String formats the amount in major units, e.g. "USD 12.50" or "IDR 150000".
+func (m Money) String() string {
+	digits := m.Currency.MinorUnitDigits()
+	if digits == 0 {
+		return fmt.Sprintf("%s %d", m.Currency, m.Amount)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := pow10(digits)
+	return fmt.Sprintf("%s %s%d.%0*d", m.Currency, sign, amount/scale, digits, amount%scale)
+}
+
+// divRound divides rounding half away from zero.
+func divRound(n, d int64) int64 {
+	if d < 0 {
+		n, d = -n, -d
+	}
+	q, r := n/d, n%d
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= d {
+		if n < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
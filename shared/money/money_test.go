@@ -0,0 +1,121 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		name string
+		n, d int64
+		want int64
+	}{
+		{"exact", 10, 5, 2},
+		{"below half", 14, 10, 1},
+		{"half rounds up", 15, 10, 2},
+		{"above half", 16, 10, 2},
+		{"negative below half", -14, 10, -1},
+		{"negative half rounds away from zero", -15, 10, -2},
+		{"negative divisor", 15, -10, -2},
+		{"both negative", -15, -10, 2},
+		{"zero", 0, 7, 0},
+		{"odd divisor half", 3, 2, 2},
+		{"odd divisor below half", 4, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := divRound(tt.n, tt.d); got != tt.want {
+				t.Errorf("divRound(%d, %d) = %d, want %d", tt.n, tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		num, den int64
+		want     Money
+	}{
+		{"11% of USD 12.50", New(1250, USD), 11, 100, New(138, USD)},
+		{"11% of IDR 15000", New(15000, IDR), 11, 100, New(1650, IDR)},
+		{"inclusive tax of IDR 111", New(111, IDR), 1100, 11100, New(11, IDR)},
+		{"half a rupiah rounds up", New(1, IDR), 1, 2, New(1, IDR)},
+		{"a third of a cent rounds down", New(1, USD), 1, 3, New(0, USD)},
+		{"negative amount rounds away from zero", New(-5, USD), 1, 2, New(-3, USD)},
+		{"whole ratio", New(999, USD), 3, 3, New(999, USD)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.MulRatio(tt.num, tt.den); got != tt.want {
+				t.Errorf("%v.MulRatio(%d, %d) = %v, want %v", tt.m, tt.num, tt.den, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1250, USD), "USD 12.50"},
+		{New(5, USD), "USD 0.05"},
+		{New(-1250, USD), "USD -12.50"},
+		{New(150000, IDR), "IDR 150000"},
+		{New(-150000, IDR), "IDR -150000"},
+		{Zero(USD), "USD 0.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.m.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		code       string
+		want       Currency
+		wantDigits int
+		wantErr    error
+	}{
+		{"USD", USD, 2, nil},
+		{" usd ", USD, 2, nil},
+		{"idr", IDR, 0, nil},
+		{"EUR", "", 0, ErrUnsupportedCurrency},
+		{"", "", 0, ErrUnsupportedCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := ParseCurrency(tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseCurrency(%q) error = %v, want %v", tt.code, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCurrency(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+			if digits := got.MinorUnitDigits(); digits != tt.wantDigits {
+				t.Errorf("MinorUnitDigits() = %d, want %d", digits, tt.wantDigits)
+			}
+		})
+	}
+}
+
+func TestArithmeticRejectsCurrencyMismatch(t *testing.T) {
+	usd, idr := New(100, USD), New(100, IDR)
+
+	if _, err := usd.Add(idr); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := usd.Sub(idr); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := usd.Cmp(idr); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+}
@@ -0,0 +1,145 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+	retention  time.Duration
+}
+
+// NewMongoRepository returns a repository that keeps delivered messages for
+// retention before MongoDB purges them.
+func NewMongoRepository(db *mongo.Database, timeout, retention time.Duration) *MongoRepository {
+	return &MongoRepository{
+		collection: db.Collection("outbox"),
+		timeout:    timeout,
+		retention:  retention,
+	}
+}
+
+// EnsureIndexes creates the indexes used by the relay to find due messages
+// and the messages they wait for, and the TTL index that purges delivered
+// messages.
+func (r *MongoRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func (r *MongoRepository) Add(ctx context.Context, message *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, message)
+	return err
+}
+
+func (r *MongoRepository) ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"status":          StatusPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"next_attempt_at": now.Add(lease)},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var message Message
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (r *MongoRepository) Blocker(ctx context.Context, message *Message) (*Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// Dates are stored in milliseconds, so messages created in the same
+	// millisecond are ordered by their ID
+	filter := bson.M{
+		"key":    message.Key,
+		"status": StatusPending,
+		"$or": bson.A{
+			bson.M{"created_at": bson.M{"$lt": message.CreatedAt}},
+			bson.M{"created_at": message.CreatedAt, "_id": bson.M{"$lt": message.ID}},
+		},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	var blocker Message
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&blocker)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &blocker, nil
+}
+
+func (r *MongoRepository) Postpone(ctx context.Context, id string, nextAttemptAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"next_attempt_at": nextAttemptAt}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *MongoRepository) MarkDelivered(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":       StatusDelivered,
+			"delivered_at": now,
+			"expires_at":   now.Add(r.retention),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *MongoRepository) MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
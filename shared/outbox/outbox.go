@@ -0,0 +1,58 @@
+// Package outbox stores events in the same transaction as the change they
+// describe and relays them to the event bus afterwards, which gives
+// at-least-once delivery.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+)
+
+// Message is an event waiting to be published. It is written in the same
+// transaction as the change it describes and published by the Relay.
+type Message struct {
+	// ID is a hex ObjectID. It orders the messages a process creates within
+	// the same millisecond, which MongoDB cannot tell apart by CreatedAt.
+	ID    string `json:"id" bson:"_id"`
+	Topic string `json:"topic" bson:"topic"`
+	// Key names what the event is about, e.g. the order. Messages with the
+	// same key are published in the order of their CreatedAt and ID.
+	Key           string     `json:"key,omitempty" bson:"key,omitempty"`
+	Payload       []byte     `json:"payload" bson:"payload"`
+	Status        Status     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	// ExpiresAt is set on delivery, the message is purged after it.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// NewMessage wraps an event about key for the outbox.
+func NewMessage(topic, key string, event interface{}) (*Message, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Message{
+		ID:            primitive.NewObjectID().Hex(),
+		Topic:         topic,
+		Key:           key,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
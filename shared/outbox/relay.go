@@ -0,0 +1,113 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	baseBackoff = time.Second
+	maxBackoff  = 5 * time.Minute
+)
+
+// Publisher is the event bus the relay publishes to. Events with the same
+// key must keep their order, e.g. by going to the same Kafka partition.
+type Publisher interface {
+	Publish(topic, key string, event interface{}) error
+}
+
+// Relay publishes the events stored in the outbox and marks them
+// delivered. Messages that fail are retried with exponential backoff, so an
+// event may be published more than once but is never lost. Messages with a
+// key are published in order: a newer message waits until the older ones of
+// its key are delivered.
+type Relay struct {
+	repo      Repository
+	publisher Publisher
+	batchSize int
+	lease     time.Duration
+}
+
+// NewRelay returns a Relay publishing up to batchSize messages per run. A
+// claimed message is left to the relay that claimed it for lease.
+func NewRelay(repo Repository, publisher Publisher, batchSize int, lease time.Duration) *Relay {
+	return &Relay{
+		repo:      repo,
+		publisher: publisher,
+		batchSize: batchSize,
+		lease:     lease,
+	}
+}
+
+// Run relays due messages every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relayBatch(ctx)
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) {
+	for i := 0; i < r.batchSize; i++ {
+		message, err := r.repo.ClaimNext(ctx, time.Now(), r.lease)
+		if err != nil {
+			log.Printf("failed to claim outbox message: %v", err)
+			return
+		}
+		if message == nil {
+			return
+		}
+
+		// A message waits for the older messages of its key, so that a failed
+		// one is not overtaken
+		if message.Key != "" {
+			blocker, err := r.repo.Blocker(ctx, message)
+			if err != nil {
+				log.Printf("failed to check the order of outbox message %s: %v", message.ID, err)
+				continue
+			}
+			if blocker != nil {
+				next := blocker.NextAttemptAt
+				if earliest := time.Now().Add(baseBackoff); next.Before(earliest) {
+					next = earliest
+				}
+				if err := r.repo.Postpone(ctx, message.ID, next); err != nil {
+					log.Printf("failed to postpone outbox message %s: %v", message.ID, err)
+				}
+				continue
+			}
+		}
+
+		if err := r.publisher.Publish(message.Topic, message.Key, json.RawMessage(message.Payload)); err != nil {
+			next := time.Now().Add(retryBackoff(message.Attempts))
+			if err := r.repo.MarkFailed(ctx, message.ID, err.Error(), next); err != nil {
+				log.Printf("failed to record outbox message %s failure: %v", message.ID, err)
+			}
+			continue
+		}
+
+		if err := r.repo.MarkDelivered(ctx, message.ID); err != nil {
+			log.Printf("failed to mark outbox message %s delivered: %v", message.ID, err)
+		}
+	}
+}
+
+func retryBackoff(attempts int) time.Duration {
+	backoff := baseBackoff
+	for i := 0; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
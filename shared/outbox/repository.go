@@ -0,0 +1,21 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	Add(ctx context.Context, message *Message) error
+	// ClaimNext locks the oldest pending message due at now for lease and
+	// returns it, or nil when there is none.
+	ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*Message, error)
+	// Blocker returns the oldest pending message with the key of message
+	// ordered before it by CreatedAt and ID, or nil when there is none.
+	Blocker(ctx context.Context, message *Message) (*Message, error)
+	// Postpone makes the message due again at nextAttemptAt without counting
+	// an attempt.
+	Postpone(ctx context.Context, id string, nextAttemptAt time.Time) error
+	MarkDelivered(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error
+}
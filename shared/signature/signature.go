@@ -0,0 +1,49 @@
+// Package signature signs and verifies messages exchanged between services
+// with an HMAC-SHA256 over a shared secret.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"shared/money"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of payload.
+func Sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of payload. An empty
+// secret never verifies.
+func Verify(secret []byte, payload, signature string) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// PaymentNotificationPayload returns the content covered by the signature of
+// a payment notification.
+func PaymentNotificationPayload(paymentID, orderID, status string, amount money.Money, occurredAt time.Time) string {
+	return strings.Join([]string{
+		paymentID,
+		orderID,
+		status,
+		strconv.FormatInt(amount.Amount, 10),
+		string(amount.Currency),
+		strconv.FormatInt(occurredAt.Unix(), 10),
+	}, "|")
+}
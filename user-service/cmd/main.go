@@ -13,13 +13,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"shared/jwt"
+	"shared/outbox"
 	"user-service/internal/config"
 	"user-service/internal/controllers"
 	"user-service/internal/infrastructure/repositories"
 	"user-service/internal/middleware"
 	"user-service/internal/services"
 	"user-service/pkg/eventbus"
-	"user-service/pkg/jwt"
 )
 
 func main() {
@@ -52,9 +53,20 @@ func main() {
 
 	// Initialize Repository
 	userRepo := repositories.NewMongoUserRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second)
+	outboxRepo := outbox.NewMongoRepository(mongoClient.Database(cfg.MongoDB), 5*time.Second, cfg.OutboxRetention)
+	if err := outboxRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("failed to create outbox indexes: %v", err)
+	}
+	transactor := repositories.NewMongoTransactor(mongoClient)
 
 	// Initialize Services
-	userService := services.NewUserService(userRepo, jwtManager, eventBus, 5*time.Second)
+	userService := services.NewUserService(userRepo, outboxRepo, transactor, jwtManager, 5*time.Second)
+	outboxRelay := outbox.NewRelay(outboxRepo, eventBus, 100, 30*time.Second)
+
+	// Publish stored events
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	go outboxRelay.Run(relayCtx, cfg.OutboxRelayInterval)
 
 	// Initialize Controllers
 	userController := controllers.NewUserController(userService, 5*time.Second)
@@ -7,6 +7,7 @@ require (
 	github.com/google/uuid v1.6.0
 	go.mongodb.org/mongo-driver v1.17.4
 	golang.org/x/crypto v0.39.0
+	shared v0.0.0
 )
 
 require (
@@ -42,3 +43,5 @@ require (
 	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace shared => ../shared
@@ -4,16 +4,19 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port         string
-	MongoURI     string
-	MongoDB      string
-	JWTSecret    string
-	KafkaBrokers []string
+	Port                string
+	MongoURI            string
+	MongoDB             string
+	JWTSecret           string
+	KafkaBrokers        []string
+	OutboxRelayInterval time.Duration
+	OutboxRetention     time.Duration
 }
 
 func Load() (*Config, error) {
@@ -22,11 +25,13 @@ func Load() (*Config, error) {
 	}
 
 	cfg := &Config{
-		Port:         getEnv("PORT", "8080"),
-		MongoURI:     getEnv("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDB:      getEnv("MONGO_DB", "user_service"),
-		JWTSecret:    getEnv("JWT_SECRET", "secret"),
-		KafkaBrokers: getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
+		Port:                getEnv("PORT", "8080"),
+		MongoURI:            getEnv("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:             getEnv("MONGO_DB", "user_service"),
+		JWTSecret:           getEnv("JWT_SECRET", "secret"),
+		KafkaBrokers:        getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}, ","),
+		OutboxRelayInterval: getEnvAsDuration("OUTBOX_RELAY_INTERVAL", time.Second),
+		OutboxRetention:     getEnvAsDuration("OUTBOX_RETENTION", 7*24*time.Hour),
 	}
 
 	return cfg, nil
@@ -45,3 +50,13 @@ func getEnvAsSlice(key string, defaultValues []string, sep string) []string {
 	}
 	return defaultValues
 }
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("invalid duration for %s, using default %s", key, defaultValue)
+	}
+	return defaultValue
+}
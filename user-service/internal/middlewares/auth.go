@@ -4,7 +4,7 @@ import (
 	"net/http"
 	"strings"
 
-	"user-service/pkg/jwt"
+	"shared/jwt"
 
 	"github.com/gin-gonic/gin"
 )
@@ -5,10 +5,10 @@ import (
 	"errors"
 	"time"
 
+	"shared/jwt"
+	"shared/outbox"
 	"user-service/internal/domain"
 	"user-service/internal/interfaces/repositories"
-	"user-service/pkg/eventbus"
-	"user-service/pkg/jwt"
 )
 
 var (
@@ -19,16 +19,18 @@ var (
 
 type UserService struct {
 	repo       repositories.UserRepository
+	outboxRepo outbox.Repository
+	transactor repositories.Transactor
 	jwtManager *jwt.Manager
-	eventBus   eventbus.EventBus
 	timeout    time.Duration
 }
 
-func NewUserService(repo repositories.UserRepository, jwtManager *jwt.Manager, eventBus eventbus.EventBus, timeout time.Duration) *UserService {
+func NewUserService(repo repositories.UserRepository, outboxRepo outbox.Repository, transactor repositories.Transactor, jwtManager *jwt.Manager, timeout time.Duration) *UserService {
 	return &UserService{
 		repo:       repo,
+		outboxRepo: outboxRepo,
+		transactor: transactor,
 		jwtManager: jwtManager,
-		eventBus:   eventBus,
 		timeout:    timeout,
 	}
 }
@@ -52,19 +54,19 @@ func (s *UserService) Register(ctx context.Context, email, password, firstName,
 		return nil, err
 	}
 
-	// Save to database
-	if err := s.repo.Create(ctx, user); err != nil {
-		return nil, err
-	}
-
-	// Publish user created event
-	go s.eventBus.Publish("user.created", map[string]interface{}{
+	// Save to database together with the user created event
+	err = s.saveWithEvent(ctx, func(ctx context.Context) error {
+		return s.repo.Create(ctx, user)
+	}, "user.created", user.ID, map[string]interface{}{
 		"id":         user.ID,
 		"email":      user.Email,
 		"first_name": user.FirstName,
 		"last_name":  user.LastName,
 		"created_at": user.CreatedAt,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -124,17 +126,35 @@ func (s *UserService) UpdateUser(ctx context.Context, id, firstName, lastName st
 	user.LastName = lastName
 	user.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(ctx, user); err != nil {
-		return nil, err
-	}
-
-	// Publish user updated event
-	go s.eventBus.Publish("user.updated", map[string]interface{}{
+	// Save to database together with the user updated event
+	err = s.saveWithEvent(ctx, func(ctx context.Context) error {
+		return s.repo.Update(ctx, user)
+	}, "user.updated", user.ID, map[string]interface{}{
 		"id":         user.ID,
 		"first_name": user.FirstName,
 		"last_name":  user.LastName,
 		"updated_at": user.UpdatedAt,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
+
+// saveWithEvent runs save and stores the event in the outbox in one
+// transaction, so the event is published if and only if the change is saved.
+// Events with the same key, the user ID, are published in order.
+func (s *UserService) saveWithEvent(ctx context.Context, save func(ctx context.Context) error, topic, key string, event interface{}) error {
+	message, err := outbox.NewMessage(topic, key, event)
+	if err != nil {
+		return err
+	}
+
+	return s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := save(ctx); err != nil {
+			return err
+		}
+		return s.outboxRepo.Add(ctx, message)
+	})
+}
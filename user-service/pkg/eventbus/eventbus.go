@@ -0,0 +1,8 @@
+package eventbus
+
+type EventBus interface {
+	// Publish sends the event to topic. Events with the same key go to the
+	// same partition and keep their order.
+	Publish(topic, key string, event interface{}) error
+	Close() error
+}
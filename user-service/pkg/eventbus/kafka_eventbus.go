@@ -14,11 +14,14 @@ type KafkaEventBus struct {
 }
 
 func NewKafkaEventBus(brokers []string) *KafkaEventBus {
+	// Writes are synchronous so that the outbox relay only marks messages
+	// delivered once Kafka has acknowledged them. Keyed messages are hashed
+	// to a partition, the others spread round robin.
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{},
 		BatchTimeout: 10 * time.Millisecond,
-		Async:        true,
+		RequiredAcks: kafka.RequireAll,
 	}
 
 	return &KafkaEventBus{
@@ -26,15 +29,20 @@ func NewKafkaEventBus(brokers []string) *KafkaEventBus {
 	}
 }
 
-func (k *KafkaEventBus) Publish(topic string, event interface{}) error {
+func (k *KafkaEventBus) Publish(topic, key string, event interface{}) error {
 	message, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
 
+	var messageKey []byte
+	if key != "" {
+		messageKey = []byte(key)
+	}
 	err = k.writer.WriteMessages(context.Background(),
 		kafka.Message{
 			Topic: topic,
+			Key:   messageKey,
 			Value: message,
 		},
 	)